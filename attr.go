@@ -3,8 +3,8 @@ package git2
 // #cgo pkg-config: libgit2
 // #include <git2.h>
 // #include <git2/attr.h>
-// extern int go_attr_callback(char *name, char *value, void *payload);
-// extern int goAttrForEach(git_repository *repo, uint32_t flags, const char *path, void *payload);
+// extern int go_attr_callback(char *name, char *value, uintptr_t payload);
+// extern int goAttrForEach(git_repository *repo, uint32_t flags, const char *path, uintptr_t payload);
 import "C"
 import (
 	"reflect"
@@ -31,14 +31,19 @@ func (repo *Repository) AddAttrMacro(name, values string) error {
 	return nil
 }
 
-func (repo *Repository) FlushAttrCache() {
-	C.git_attr_cache_flush(repo.git_repository)
+func (repo *Repository) FlushAttrCache() error {
+	ecode := C.git_attr_cache_flush(repo.git_repository)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
 }
 
 func (repo *Repository) ForEachAttr(flags AttrFlag, path string, callback AttrCallback, payload interface{}) error {
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
-	data := unsafe.Pointer(&attrCallbackWrapper{callback, payload})
+	data := trackCallback(&attrCallbackWrapper{callback, payload})
+	defer untrackCallback(data)
 	ecode := C.goAttrForEach(repo.git_repository, C.uint32_t(flags), cpath, data)
 	if ecode != git_SUCCESS {
 		return gitError()
@@ -54,8 +59,8 @@ type attrCallbackWrapper struct {
 }
 
 //export go_attr_callback
-func go_attr_callback(name, value *C.char, payload unsafe.Pointer) C.int {
-	wrap := (*attrCallbackWrapper)(payload)
+func go_attr_callback(name, value *C.char, payload C.uintptr_t) C.int {
+	wrap := lookupCallback(payload).(*attrCallbackWrapper)
 	err := wrap.f(C.GoString(name), C.GoString(value), wrap.d)
 	if err != nil {
 		return C.int(git_SUCCESS - 1)
@@ -65,8 +70,7 @@ func go_attr_callback(name, value *C.char, payload unsafe.Pointer) C.int {
 
 // TODO: Use varargs, find other places to use it as well.
 func (repo *Repository) GetAttr(path, name string, flags ...AttrFlag) (string, error) {
-	var value [1]int8
-	cvalue := (*C.char)(&value[0])
+	var cvalue *C.char
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
 	cname := C.CString(name)
@@ -85,13 +89,17 @@ func (repo *Repository) GetAttr(path, name string, flags ...AttrFlag) (string, e
 }
 
 func (repo *Repository) GetManyAttrs(path string, names []string, flags ...AttrFlag) ([]string, error) {
-	var values [1]int8
-	cvalues := (*C.char)(&values[0])
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
 
 	length := len(names)
+	if length == 0 {
+		return nil, nil
+	}
 	clength := C.size_t(length)
+	var ptr *C.char
+	cvalues := (**C.char)(C.calloc(clength, C.size_t(unsafe.Sizeof(ptr))))
+	defer C.free(unsafe.Pointer(cvalues))
 	cnames := make([]*C.char, length)
 	for i := 0; i < length; i++ {
 		cnames[i] = C.CString(names[i])
@@ -103,7 +111,7 @@ func (repo *Repository) GetManyAttrs(path string, names []string, flags ...AttrF
 		cflags |= C.uint32_t(flag)
 	}
 
-	ecode := C.git_attr_get_many(&cvalues, repo.git_repository, cflags, cpath, clength, &cnames[0])
+	ecode := C.git_attr_get_many(cvalues, repo.git_repository, cflags, cpath, clength, &cnames[0])
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
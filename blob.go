@@ -30,7 +30,7 @@ func (repo *Repository) LookupBlob(oid *Oid) (*Blob, error) {
 
 func (repo *Repository) LookupBlobPrefix(oid *Oid, n uint) (*Blob, error) {
 	blob := new(Blob)
-	ecode := C.git_blob_lookup_prefix(&blob.git_blob, repo.git_repository, oid.git_oid, C.uint(n))
+	ecode := C.git_blob_lookup_prefix(&blob.git_blob, repo.git_repository, oid.git_oid, C.size_t(n))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -40,10 +40,13 @@ func (repo *Repository) LookupBlobPrefix(oid *Oid, n uint) (*Blob, error) {
 // Create a blob from byte slice.
 func (repo *Repository) CreateBlob(buffer []byte) (*Oid, error) {
 	oid := new(Oid)
-	cbuffer := unsafe.Pointer(&buffer[0])
-	defer C.free(cbuffer)
+	oid.git_oid = new(C.git_oid)
+	var cbuffer unsafe.Pointer
+	if len(buffer) > 0 {
+		cbuffer = unsafe.Pointer(&buffer[0])
+	}
 	length := C.size_t(len(buffer))
-	ecode := C.git_blob_create_frombuffer(oid.git_oid, repo.git_repository, cbuffer, length)
+	ecode := C.git_blob_create_from_buffer(oid.git_oid, repo.git_repository, cbuffer, length)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -53,9 +56,10 @@ func (repo *Repository) CreateBlob(buffer []byte) (*Oid, error) {
 // Create a blob from a file.
 func (repo *Repository) CreateBlobFromFile(path string) (*Oid, error) {
 	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
-	ecode := C.git_blob_create_fromdisk(oid.git_oid, repo.git_repository, cpath)
+	ecode := C.git_blob_create_from_disk(oid.git_oid, repo.git_repository, cpath)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -65,9 +69,10 @@ func (repo *Repository) CreateBlobFromFile(path string) (*Oid, error) {
 // Create a blob from a file, relative to the repo's workdir.
 func (repo *Repository) CreateBlobFromWorkdir(path string) (*Oid, error) {
 	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
-	ecode := C.git_blob_create_fromfile(oid.git_oid, repo.git_repository, cpath)
+	ecode := C.git_blob_create_from_workdir(oid.git_oid, repo.git_repository, cpath)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -5,7 +5,6 @@ package git2
 // #include <git2/branch.h>
 import "C"
 import (
-	"reflect"
 	"unsafe"
 )
 
@@ -17,26 +16,50 @@ const (
 	BRANCH_ALL = BRANCH_LOCAL | BRANCH_REMOTE
 )
 
+const (
+	git_ITEROVER = -31
+)
+
 func (repo *Repository) CreateBranch(name string, target *Object, force bool) (*Oid, error) {
-	oid := new(Oid)
+	var commit *C.git_object
+	ecode := C.git_object_peel(&commit, target.git_object, C.GIT_OBJECT_COMMIT)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	defer C.git_object_free(commit)
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 	cforce := C.int(c_FALSE)
 	if force {
 		cforce = C.int(c_TRUE)
 	}
-	ecode := C.git_branch_create(oid.git_oid, repo.git_repository, cname, target.git_object, cforce)
+	var ref *C.git_reference
+	ecode = C.git_branch_create(&ref, repo.git_repository, cname, (*C.git_commit)(unsafe.Pointer(commit)), cforce)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
-	return oid, nil
+	defer C.git_reference_free(ref)
+	return newOidFromC(C.git_reference_target(ref)), nil
 }
 
-func (repo *Repository) DeleteBranch(name string, flag BranchType) error {
+func (repo *Repository) lookupBranch(name string, flag BranchType) (*C.git_reference, error) {
+	var ref *C.git_reference
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	cflag := C.git_branch_t(flag)
-	ecode := C.git_branch_delete(repo.git_repository, cname, cflag)
+	ecode := C.git_branch_lookup(&ref, repo.git_repository, cname, C.git_branch_t(flag))
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return ref, nil
+}
+
+func (repo *Repository) DeleteBranch(name string, flag BranchType) error {
+	ref, err := repo.lookupBranch(name, flag)
+	if err != nil {
+		return err
+	}
+	defer C.git_reference_free(ref)
+	ecode := C.git_branch_delete(ref)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
@@ -44,49 +67,60 @@ func (repo *Repository) DeleteBranch(name string, flag BranchType) error {
 }
 
 func (repo *Repository) ListBranches(flags ...BranchType) ([]string, error) {
-	var cnames C.git_strarray
-	defer C.git_strarray_free(&cnames)
-	var cflags C.uint
+	var cflags C.git_branch_t
 	if len(flags) == 0 {
-		cflags = C.uint(BRANCH_ALL)
+		cflags = C.git_branch_t(BRANCH_ALL)
 	} else {
 		for _, flag := range flags {
-			cflags |= C.uint(flag)
+			cflags |= C.git_branch_t(flag)
 		}
 	}
-	ecode := C.git_branch_list(&cnames, repo.git_repository, cflags)
+	var iter *C.git_branch_iterator
+	ecode := C.git_branch_iterator_new(&iter, repo.git_repository, cflags)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
+	defer C.git_branch_iterator_free(iter)
 
-	// TODO: Find a safer way if one exists.
-	var namesSlice reflect.SliceHeader
-	length := int(cnames.count)
-	namesSlice.Data = uintptr(unsafe.Pointer(cnames.strings))
-	namesSlice.Len = length
-	namesSlice.Cap = length
-	cnameStrings := *(*[]*C.char)(unsafe.Pointer(&namesSlice))
-
-	names := make([]string, length)
-	for i := 0; i < len(cnameStrings); i++ {
-		names[i] = C.GoString(cnameStrings[i])
+	var names []string
+	for {
+		var ref *C.git_reference
+		var branchType C.git_branch_t
+		ecode = C.git_branch_next(&ref, &branchType, iter)
+		if ecode == git_ITEROVER {
+			break
+		} else if ecode != git_SUCCESS {
+			return nil, gitError()
+		}
+		var cname *C.char
+		ecode = C.git_branch_name(&cname, ref)
+		if ecode != git_SUCCESS {
+			C.git_reference_free(ref)
+			return nil, gitError()
+		}
+		names = append(names, C.GoString(cname))
+		C.git_reference_free(ref)
 	}
-
 	return names, nil
 }
 
 func (repo *Repository) MoveBranch(oldName, newName string, force bool) error {
-	coldName := C.CString(oldName)
-	defer C.free(unsafe.Pointer(coldName))
+	ref, err := repo.lookupBranch(oldName, BRANCH_LOCAL)
+	if err != nil {
+		return err
+	}
+	defer C.git_reference_free(ref)
 	cnewName := C.CString(newName)
 	defer C.free(unsafe.Pointer(cnewName))
 	cforce := C.int(c_FALSE)
 	if force {
 		cforce = C.int(c_TRUE)
 	}
-	ecode := C.git_branch_move(repo.git_repository, coldName, cnewName, cforce)
+	var moved *C.git_reference
+	ecode := C.git_branch_move(&moved, ref, cnewName, cforce)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
+	C.git_reference_free(moved)
 	return nil
 }
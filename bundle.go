@@ -0,0 +1,305 @@
+package git2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	BUNDLE_V2 = 2
+	BUNDLE_V3 = 3
+)
+
+// Bundle files can be fetched and cloned from with URLs of the form
+// "bundle:///path/to/file.bundle" once the transport is registered, which
+// Init does. Clone and the remotes of a repository also take the plain path
+// of a bundle file.
+const BUNDLE_URL_PREFIX = "bundle://"
+
+var bundleSignatures = []string{"# v2 git bundle\n", "# v3 git bundle\n"}
+
+type BundleRef struct {
+	Name string
+	Id   *Oid
+}
+
+// The part of a bundle file in front of the pack.
+type BundleHeader struct {
+	Version int
+	// The "@key=value" lines of a v3 bundle, a key without a value maps
+	// to "".
+	Capabilities map[string]string
+	// Commits the pack is based on, which the receiving repository must
+	// already have.
+	Prerequisites []*Oid
+	References    []BundleRef
+}
+
+// Write a bundle holding the references named by refs, e.g.
+// "refs/heads/master" or "HEAD", along with everything they need except
+// what is reachable from the commits in exclusions, which become the
+// bundle's prerequisites.
+func CreateBundle(w io.Writer, repo *Repository, refs []string, exclusions []*Oid) error {
+	return CreateBundleVersion(w, repo, refs, exclusions, BUNDLE_V2)
+}
+
+// Like CreateBundle, writing either a BUNDLE_V2 or a BUNDLE_V3 bundle.
+func CreateBundleVersion(w io.Writer, repo *Repository, refs []string, exclusions []*Oid, version int) error {
+	if version != BUNDLE_V2 && version != BUNDLE_V3 {
+		return fmt.Errorf("git2: unsupported bundle version %d", version)
+	}
+
+	var wants []*Oid
+	var references []BundleRef
+	for _, name := range refs {
+		ref, err := repo.LookupReference(name)
+		if err != nil {
+			return err
+		}
+		id, err := repo.referenceTarget(ref)
+		ref.Free()
+		if err != nil {
+			return err
+		}
+		wants = append(wants, id)
+		references = append(references, BundleRef{name, id})
+	}
+	if len(references) == 0 {
+		return errors.New("git2: refusing to create an empty bundle")
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# v%d git bundle\n", version)
+	if version == BUNDLE_V3 {
+		fmt.Fprintf(bw, "@object-format=sha1\n")
+	}
+	var prerequisites []*Oid
+	for _, id := range exclusions {
+		commit, err := repo.exclusionCommit(id)
+		if err != nil {
+			return err
+		}
+		summary := strings.SplitN(commit.Message(), "\n", 2)[0]
+		id = commit.Id()
+		fmt.Fprintf(bw, "-%s %s\n", id, summary)
+		prerequisites = append(prerequisites, id.Copy())
+		commit.Free()
+	}
+	for _, ref := range references {
+		fmt.Fprintf(bw, "%s %s\n", ref.Id, ref.Name)
+	}
+	fmt.Fprintf(bw, "\n")
+
+	if err := repo.writeUploadPack(bw, wants, prerequisites, nil, 0); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// The commit an exclusion stands for, peeling annotated tags. Anything
+// else cannot be a prerequisite of a bundle.
+func (repo *Repository) exclusionCommit(id *Oid) (*Commit, error) {
+	obj, err := repo.LookupObject(id, OBJ_ANY)
+	if err != nil {
+		return nil, err
+	}
+	objType := obj.Type()
+	obj.Free()
+	if objType == OBJ_TAG {
+		peeled := repo.peelTag(id)
+		if peeled == nil {
+			return nil, errors.New("git2: cannot peel the excluded tag " + id.String())
+		}
+		id = peeled
+	}
+	commit, err := repo.LookupCommit(id)
+	if err != nil {
+		return nil, errors.New("git2: excluded object " + id.String() + " is not a commit")
+	}
+	return commit, nil
+}
+
+// Read the header of a bundle, leaving r at the start of the pack.
+func ReadBundleHeader(r *bufio.Reader) (*BundleHeader, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	header := &BundleHeader{Capabilities: make(map[string]string)}
+	switch line {
+	case bundleSignatures[0]:
+		header.Version = BUNDLE_V2
+	case bundleSignatures[1]:
+		header.Version = BUNDLE_V3
+	default:
+		return nil, errors.New("git2: not a bundle")
+	}
+
+	for {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+
+		if header.Version == BUNDLE_V3 && strings.HasPrefix(line, "@") {
+			kv := strings.SplitN(line[1:], "=", 2)
+			if len(kv) == 1 {
+				kv = append(kv, "")
+			}
+			header.Capabilities[kv[0]] = kv[1]
+			continue
+		}
+
+		prerequisite := strings.HasPrefix(line, "-")
+		line = strings.TrimPrefix(line, "-")
+		fields := strings.SplitN(line, " ", 2)
+		id, err := parseOid(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		if prerequisite {
+			header.Prerequisites = append(header.Prerequisites, id)
+		} else if len(fields) == 2 {
+			header.References = append(header.References, BundleRef{fields[1], id})
+		} else {
+			return nil, errors.New("git2: malformed bundle reference " + line)
+		}
+	}
+
+	if format, ok := header.Capabilities["object-format"]; ok && format != "sha1" {
+		return nil, errors.New("git2: unsupported bundle object format " + format)
+	}
+	return header, nil
+}
+
+// Whether path names a bundle file, judging by its first line.
+func isBundleFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	signature := make([]byte, len(bundleSignatures[0]))
+	if _, err = io.ReadFull(f, signature); err != nil {
+		return false
+	}
+	for _, s := range bundleSignatures {
+		if string(signature) == s {
+			return true
+		}
+	}
+	return false
+}
+
+func readBundleFile(path string) (*BundleHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadBundleHeader(bufio.NewReader(f))
+}
+
+// Check that repo has every commit the bundle at path needs and return the
+// bundle's header.
+func VerifyBundle(path string, repo *Repository) (*BundleHeader, error) {
+	header, err := readBundleFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, id := range header.Prerequisites {
+		commit, err := repo.LookupCommit(id)
+		if err != nil {
+			missing = append(missing, id.String())
+			continue
+		}
+		commit.Free()
+	}
+	if len(missing) > 0 {
+		return header, errors.New("git2: repository lacks the prerequisite commits " + strings.Join(missing, ", "))
+	}
+	return header, nil
+}
+
+// A connection to a bundle file that plays upload-pack on the other end.
+type bundleConn struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (conn *bundleConn) Close() error {
+	conn.PipeReader.Close()
+	return conn.PipeWriter.Close()
+}
+
+// Register the transport fetching from BUNDLE_URL_PREFIX URLs. Init calls
+// this, so it is only needed after UnregisterTransport(BUNDLE_URL_PREFIX).
+func RegisterBundleTransport() error {
+	return RegisterTransport(BUNDLE_URL_PREFIX, openBundle)
+}
+
+func openBundle(url string, service SmartService) (io.ReadWriteCloser, error) {
+	if service != SERVICE_UPLOADPACK_LS {
+		return nil, errors.New("git2: bundles cannot be pushed to")
+	}
+	path := strings.TrimPrefix(url, BUNDLE_URL_PREFIX)
+	if _, err := readBundleFile(path); err != nil {
+		return nil, err
+	}
+
+	requests, requestWriter := io.Pipe()
+	responseReader, responses := io.Pipe()
+	go func() {
+		err := serveBundle(path, requests, responses)
+		requests.CloseWithError(err)
+		responses.CloseWithError(err)
+	}()
+	return &bundleConn{responseReader, requestWriter}, nil
+}
+
+// The whole pack is sent whatever the client asked for, the bundle's
+// prerequisites and references being what is acknowledged as common.
+func serveBundle(path string, r io.Reader, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bundle := bufio.NewReader(f)
+	header, err := ReadBundleHeader(bundle)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool)
+	for _, id := range header.Prerequisites {
+		known[id.String()] = true
+	}
+	refs := make([]advertisedRef, len(header.References))
+	for i, ref := range header.References {
+		refs[i] = advertisedRef{name: ref.Name, id: ref.Id}
+		known[ref.Id.String()] = true
+	}
+	if err = writeAdvertisement(w, refs, "ofs-delta "+git_AGENT); err != nil {
+		return err
+	}
+
+	has := func(id *Oid) bool {
+		return known[id.String()]
+	}
+	req, err := readUploadRequest(bufio.NewReader(r), w, false, has, nil)
+	if req == nil {
+		return err
+	}
+	_, err = io.Copy(w, bundle)
+	return err
+}
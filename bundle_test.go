@@ -0,0 +1,134 @@
+package git2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Write a bundle of HEAD and the branch it points at to a temporary file.
+func createTestBundle(t *testing.T, repo *Repository, exclusions []*Oid) (string, func()) {
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch := head.Name()
+	head.Free()
+
+	var buf bytes.Buffer
+	if err = CreateBundle(&buf, repo, []string{"HEAD", branch}, exclusions); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "git2-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "repo.bundle")
+	if err = ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestCloneBundlePath(t *testing.T) {
+	src, head, path, cleanup := createCloneSource(t)
+	defer cleanup()
+	bundle, cleanupBundle := createTestBundle(t, src, nil)
+	defer cleanupBundle()
+
+	repo, err := Clone(bundle, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Free()
+	checkCloneHead(t, repo, head)
+}
+
+func TestFetchBundlePath(t *testing.T) {
+	src, cleanupSrc := createTestRepo(t, false)
+	defer cleanupSrc()
+	head := commitTestFiles(t, src, map[string]string{"file": "content"}, "first")
+	bundle, cleanupBundle := createTestBundle(t, src, nil)
+	defer cleanupBundle()
+
+	repo, cleanup := createTestRepo(t, true)
+	defer cleanup()
+	added, err := repo.AddRemote("bundle", bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added.Free()
+	remote, err := repo.LoadRemote("bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Free()
+	if err = remote.Fetch(nil, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	odb, err := repo.Odb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer odb.Free()
+	if !odb.Exists(head) {
+		t.Errorf("commit %s was not fetched", head)
+	}
+	// Only the remote's instance talks to the bundle transport.
+	if url, err := remote.ConfiguredUrl(); err != nil || url != bundle {
+		t.Errorf("configured URL is %q, %v", url, err)
+	}
+}
+
+func TestRegisterBundleTransport(t *testing.T) {
+	// Init has registered it already.
+	if err := RegisterBundleTransport(); err == nil {
+		t.Error("registering the bundle transport twice succeeded")
+	}
+	if err := UnregisterTransport(BUNDLE_URL_PREFIX); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterBundleTransport(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateBundleExclusions(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	first := commitTestFiles(t, repo, map[string]string{"file": "one"}, "first")
+	commitTestFiles(t, repo, map[string]string{"file": "two"}, "second")
+
+	target, err := repo.LookupObject(first, OBJ_COMMIT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Free()
+	sig := testSignature(t)
+	defer sig.Free()
+	tag, err := repo.CreateTag("v1", target, sig, "version one", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An annotated tag stands for the commit it points at.
+	bundle, cleanupBundle := createTestBundle(t, repo, []*Oid{tag})
+	defer cleanupBundle()
+	header, err := VerifyBundle(bundle, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(header.Prerequisites) != 1 || header.Prerequisites[0].Compare(first) != 0 {
+		t.Errorf("prerequisites are %v, want [%s]", header.Prerequisites, first)
+	}
+
+	blob := testBlobId(t, repo, "not a commit")
+	var buf bytes.Buffer
+	if err = CreateBundle(&buf, repo, []string{"HEAD"}, []*Oid{blob}); err == nil {
+		t.Error("a blob was accepted as an exclusion")
+	}
+}
@@ -0,0 +1,95 @@
+package git2
+
+// #cgo pkg-config: libgit2
+// #include <git2.h>
+import "C"
+import (
+	"crypto/x509"
+	"errors"
+	"unsafe"
+)
+
+type CertificateKind int
+
+const (
+	CERT_NONE CertificateKind = iota
+	CERT_X509
+	CERT_HOSTKEY_LIBSSH2
+	CERT_STRARRAY
+)
+
+type HostkeyKind uint
+
+const (
+	HOSTKEY_MD5 HostkeyKind = 1 << iota
+	HOSTKEY_SHA1
+	HOSTKEY_SHA256
+	HOSTKEY_RAW
+)
+
+// The algorithm of a raw SSH host key.
+type HostkeyRawType int
+
+const (
+	HOSTKEY_RAW_UNKNOWN HostkeyRawType = iota
+	HOSTKEY_RAW_RSA
+	HOSTKEY_RAW_DSS
+	HOSTKEY_RAW_ECDSA_256
+	HOSTKEY_RAW_ECDSA_384
+	HOSTKEY_RAW_ECDSA_521
+	HOSTKEY_RAW_ED25519
+)
+
+// The certificate presented by a server: an X.509 certificate for HTTPS or
+// the fingerprints of the host key for SSH. Other kinds of certificate
+// only carry their Kind.
+type Certificate struct {
+	Kind    CertificateKind
+	X509    *x509.Certificate
+	Hostkey HostkeyCertificate
+}
+
+type HostkeyCertificate struct {
+	// Which of the hashes are set.
+	Kind       HostkeyKind
+	HashMD5    [16]byte
+	HashSHA1   [20]byte
+	HashSHA256 [32]byte
+	// With HOSTKEY_RAW, the host key in the SSH wire format as sent by the
+	// server, e.g. for checking against known_hosts.
+	RawType HostkeyRawType
+	Raw     []byte
+}
+
+// Return nil to accept the certificate, an error rejects it and aborts the
+// connection. valid says whether libgit2 considers the certificate valid.
+type CertificateCheckCallback func(cert *Certificate, valid bool, hostname string, payload interface{}) error
+
+func newCertificateFromC(ccert *C.git_cert) (*Certificate, error) {
+	cert := &Certificate{Kind: CertificateKind(ccert.cert_type)}
+	switch cert.Kind {
+	case CERT_X509:
+		cx509 := (*C.git_cert_x509)(unsafe.Pointer(ccert))
+		der := C.GoBytes(cx509.data, C.int(cx509.len))
+		parsed, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		cert.X509 = parsed
+	case CERT_HOSTKEY_LIBSSH2:
+		chostkey := (*C.git_cert_hostkey)(unsafe.Pointer(ccert))
+		cert.Hostkey.Kind = HostkeyKind(chostkey._type)
+		copy(cert.Hostkey.HashMD5[:], C.GoBytes(unsafe.Pointer(&chostkey.hash_md5[0]), 16))
+		copy(cert.Hostkey.HashSHA1[:], C.GoBytes(unsafe.Pointer(&chostkey.hash_sha1[0]), 20))
+		copy(cert.Hostkey.HashSHA256[:], C.GoBytes(unsafe.Pointer(&chostkey.hash_sha256[0]), 32))
+		if cert.Hostkey.Kind&HOSTKEY_RAW != 0 {
+			cert.Hostkey.RawType = HostkeyRawType(chostkey.raw_type)
+			cert.Hostkey.Raw = C.GoBytes(unsafe.Pointer(chostkey.hostkey), C.int(chostkey.hostkey_len))
+		}
+	case CERT_NONE, CERT_STRARRAY:
+		// Nothing libgit2 describes publicly, only the kind is known.
+	default:
+		return nil, errors.New("git2: unsupported certificate type")
+	}
+	return cert, nil
+}
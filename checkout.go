@@ -0,0 +1,98 @@
+package git2
+
+// #cgo pkg-config: libgit2
+// #include <git2.h>
+import "C"
+import (
+	"os"
+)
+
+type CheckoutStrategy uint
+
+const CHECKOUT_NONE CheckoutStrategy = iota
+const (
+	CHECKOUT_SAFE CheckoutStrategy = 1 << iota
+	CHECKOUT_FORCE
+	CHECKOUT_RECREATE_MISSING
+	_
+	CHECKOUT_ALLOW_CONFLICTS
+	CHECKOUT_REMOVE_UNTRACKED
+	CHECKOUT_REMOVE_IGNORED
+	CHECKOUT_UPDATE_ONLY
+	CHECKOUT_DONT_UPDATE_INDEX
+	CHECKOUT_NO_REFRESH
+)
+
+// Like CHECKOUT_SAFE, but also create the files missing from the working
+// directory.
+const CHECKOUT_SAFE_CREATE = CHECKOUT_SAFE | CHECKOUT_RECREATE_MISSING
+
+type CheckoutOpts struct {
+	Strategy       CheckoutStrategy
+	DisableFilters bool
+	DirMode        os.FileMode
+	FileMode       os.FileMode
+	FileOpenFlags  int
+	Paths          []string
+}
+
+// Fill in a git_checkout_options from opts, the caller must call
+// freeCheckoutOpts once libgit2 is done with it.
+func populateCheckoutOpts(copts *C.git_checkout_options, opts *CheckoutOpts) {
+	copts.version = C.GIT_CHECKOUT_OPTIONS_VERSION
+	if opts == nil {
+		copts.checkout_strategy = C.uint(CHECKOUT_SAFE)
+		return
+	}
+	copts.checkout_strategy = C.uint(opts.Strategy)
+	if opts.DisableFilters {
+		copts.disable_filters = C.int(c_TRUE)
+	}
+	copts.dir_mode = C.uint(opts.DirMode.Perm())
+	copts.file_mode = C.uint(opts.FileMode.Perm())
+	copts.file_open_flags = C.int(opts.FileOpenFlags)
+	if len(opts.Paths) > 0 {
+		copts.paths = *makeCStrarray(opts.Paths)
+	}
+}
+
+func freeCheckoutOpts(copts *C.git_checkout_options) {
+	freeCStrarray(&copts.paths)
+}
+
+func (repo *Repository) CheckoutHead(opts *CheckoutOpts) error {
+	var copts C.git_checkout_options
+	populateCheckoutOpts(&copts, opts)
+	defer freeCheckoutOpts(&copts)
+	ecode := C.git_checkout_head(repo.git_repository, &copts)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+func (repo *Repository) CheckoutIndex(index *Index, opts *CheckoutOpts) error {
+	var copts C.git_checkout_options
+	populateCheckoutOpts(&copts, opts)
+	defer freeCheckoutOpts(&copts)
+	var cindex *C.git_index
+	if index != nil {
+		cindex = index.git_index
+	}
+	ecode := C.git_checkout_index(repo.git_repository, cindex, &copts)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+func (repo *Repository) CheckoutTree(treeish *Object, opts *CheckoutOpts) error {
+	var copts C.git_checkout_options
+	populateCheckoutOpts(&copts, opts)
+	defer freeCheckoutOpts(&copts)
+	ecode := C.git_checkout_tree(repo.git_repository, treeish.git_object, &copts)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
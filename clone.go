@@ -0,0 +1,268 @@
+package git2
+
+// #cgo pkg-config: libgit2
+// #include <git2.h>
+import "C"
+import (
+	"errors"
+	"os"
+	"strings"
+	"unsafe"
+)
+
+const git_DEFAULT_REMOTE_NAME = "origin"
+
+type CloneOptions struct {
+	Bare             bool
+	IgnoreCertErrors bool
+	// Progress, credential and reference update callbacks for the fetch.
+	Callbacks *RemoteCallbacks
+	// Fetch only this many commits of history, making the clone shallow.
+	Depth int
+	// Remote to create, defaults to "origin".
+	RemoteName string
+	// Branch to check out instead of the remote's HEAD.
+	CheckoutBranch string
+	// Defaults to CHECKOUT_SAFE_CREATE when nil.
+	CheckoutOpts *CheckoutOpts
+	// When set, called to create the remote instead of the default
+	// AddRemote(RemoteName, url).
+	RemoteCreateCallback RemoteCreateCallback
+	RemoteCreatePayload  interface{}
+}
+
+type RemoteCreateCallback func(repo *Repository, name, url string, payload interface{}) (*Remote, error)
+
+func Clone(url, path string, opts *CloneOptions) (*Repository, error) {
+	if opts == nil {
+		opts = new(CloneOptions)
+	}
+	if isBundleFile(url) {
+		url = BUNDLE_URL_PREFIX + url
+	}
+	// libgit2 only knows how to create a remote called origin by itself.
+	if opts.RemoteCreateCallback != nil || opts.RemoteName != "" {
+		return cloneWithCallback(url, path, opts)
+	}
+
+	curl := C.CString(url)
+	defer C.free(unsafe.Pointer(curl))
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	var copts C.git_clone_options
+	C.git_clone_options_init(&copts, C.GIT_CLONE_OPTIONS_VERSION)
+	populateCheckoutOpts(&copts.checkout_opts, cloneCheckoutOpts(opts))
+	defer freeCheckoutOpts(&copts.checkout_opts)
+	populateFetchOptions(&copts.fetch_opts, cloneFetchOptions(opts))
+	defer freeFetchOptions(&copts.fetch_opts)
+	if opts.Bare {
+		copts.bare = C.int(c_TRUE)
+	}
+	if opts.CheckoutBranch != "" {
+		copts.checkout_branch = C.CString(opts.CheckoutBranch)
+		defer C.free(unsafe.Pointer(copts.checkout_branch))
+	}
+
+	repo := new(Repository)
+	ecode := C.git_clone(&repo.git_repository, curl, cpath, &copts)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return repo, nil
+}
+
+func cloneCheckoutOpts(opts *CloneOptions) *CheckoutOpts {
+	if opts.CheckoutOpts == nil {
+		return &CheckoutOpts{Strategy: CHECKOUT_SAFE_CREATE}
+	}
+	return opts.CheckoutOpts
+}
+
+// libgit2 1.x dropped ignore_cert_errors, so accept every certificate
+// through the certificate check callback instead.
+func cloneFetchOptions(opts *CloneOptions) *FetchOptions {
+	callbacks := opts.Callbacks
+	if opts.IgnoreCertErrors {
+		ignoring := new(RemoteCallbacks)
+		if callbacks != nil {
+			*ignoring = *callbacks
+		}
+		check := ignoring.CertificateCheck
+		ignoring.CertificateCheck = func(cert *Certificate, valid bool, hostname string, payload interface{}) error {
+			if check == nil {
+				return nil
+			}
+			return check(cert, true, hostname, payload)
+		}
+		callbacks = ignoring
+	}
+	return &FetchOptions{Callbacks: callbacks, Depth: opts.Depth}
+}
+
+// Initialise the repository ourselves so the caller can create the remote,
+// then fetch into it and check out the branch. This is what
+// git_clone_into did before libgit2 1.0 removed it.
+func cloneWithCallback(url, path string, opts *CloneOptions) (*Repository, error) {
+	_, err := os.Stat(path)
+	created := os.IsNotExist(err)
+
+	repo, err := InitRepository(path, opts.Bare)
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (*Repository, error) {
+		repo.Free()
+		if created {
+			os.RemoveAll(path)
+		}
+		return nil, err
+	}
+
+	name := opts.RemoteName
+	if name == "" {
+		name = git_DEFAULT_REMOTE_NAME
+	}
+	var remote *Remote
+	if opts.RemoteCreateCallback != nil {
+		remote, err = opts.RemoteCreateCallback(repo, name, url, opts.RemoteCreatePayload)
+	} else {
+		remote, err = repo.AddRemote(name, url)
+	}
+	if err == nil && remote == nil {
+		err = errors.New("git2: the remote create callback returned no remote")
+	}
+	if err != nil {
+		if remote != nil {
+			remote.Free()
+		}
+		return fail(err)
+	}
+
+	// The remote belongs to repo, so free it before fail frees the
+	// repository.
+	err = repo.cloneInto(remote, opts)
+	remote.Free()
+	if err != nil {
+		return fail(err)
+	}
+	return repo, nil
+}
+
+// Fetch everything from remote, then point HEAD at CheckoutBranch or at the
+// branch the remote's HEAD names and check it out.
+func (repo *Repository) cloneInto(remote *Remote, opts *CloneOptions) error {
+	fetchOpts := cloneFetchOptions(opts)
+	fetchOpts.DownloadTags = DOWNLOAD_TAGS_ALL
+	fetchOpts.SkipFetchhead = true
+	err := remote.Fetch(nil, fetchOpts, "clone: from "+remote.Url())
+	if err != nil {
+		return err
+	}
+	// The advertised references stay available after the fetch disconnects.
+	heads, err := remote.Ls()
+	if err != nil {
+		return err
+	}
+
+	branch := opts.CheckoutBranch
+	var detached *Oid
+	if branch == "" {
+		branch, detached = remoteHeadBranch(heads)
+	}
+	switch {
+	case branch != "":
+		err = repo.cloneBranch(remote, branch, opts.CheckoutBranch != "")
+	case detached != nil:
+		err = repo.setHeadDetached(detached)
+	default:
+		// An empty remote leaves HEAD unborn.
+		return nil
+	}
+	if err != nil || opts.Bare {
+		return err
+	}
+	return repo.CheckoutHead(cloneCheckoutOpts(opts))
+}
+
+// The branch the remote's HEAD points at, or the commit it is detached at
+// when no branch matches.
+func remoteHeadBranch(heads []RemoteHead) (string, *Oid) {
+	for _, head := range heads {
+		if head.Name != "HEAD" {
+			continue
+		}
+		if strings.HasPrefix(head.SymrefTarget, "refs/heads/") {
+			return strings.TrimPrefix(head.SymrefTarget, "refs/heads/"), nil
+		}
+		// Without the symref capability guess the branch from the id, as
+		// libgit2 does.
+		for _, other := range heads {
+			if strings.HasPrefix(other.Name, "refs/heads/") && other.Id.Compare(head.Id) == 0 {
+				return strings.TrimPrefix(other.Name, "refs/heads/"), nil
+			}
+		}
+		return "", head.Id
+	}
+	return "", nil
+}
+
+// Create branch from its remote-tracking reference, set it to track the
+// remote and point HEAD at it. Unless required, a branch missing from the
+// remote becomes an unborn HEAD.
+func (repo *Repository) cloneBranch(remote *Remote, branch string, required bool) error {
+	refname := "refs/heads/" + branch
+	spec := remote.Fetchspec()
+	if spec == nil {
+		return errors.New("git2: the remote has no fetch refspec")
+	}
+	tracking, err := spec.Transform(refname)
+	if err != nil {
+		return err
+	}
+	id, err := repo.ReferenceNameToOid(tracking)
+	if IsNotFound(err) && !required {
+		return repo.setHead(refname)
+	} else if err != nil {
+		return err
+	}
+
+	commit, err := repo.LookupObject(id, OBJ_COMMIT)
+	if err != nil {
+		return err
+	}
+	defer commit.Free()
+	if _, err = repo.CreateBranch(branch, commit, false); err != nil {
+		return err
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	defer cfg.Free()
+	if err = cfg.SetString("branch."+branch+".remote", remote.Name()); err != nil {
+		return err
+	}
+	if err = cfg.SetString("branch."+branch+".merge", refname); err != nil {
+		return err
+	}
+	return repo.setHead(refname)
+}
+
+func (repo *Repository) setHead(refname string) error {
+	crefname := C.CString(refname)
+	defer C.free(unsafe.Pointer(crefname))
+	ecode := C.git_repository_set_head(repo.git_repository, crefname)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+func (repo *Repository) setHeadDetached(id *Oid) error {
+	ecode := C.git_repository_set_head_detached(repo.git_repository, id.git_oid)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
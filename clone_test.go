@@ -0,0 +1,208 @@
+package git2
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A repository with one commit to clone from, and a directory to clone
+// into.
+func createCloneSource(t *testing.T) (*Repository, *Oid, string, func()) {
+	src, cleanupSrc := createTestRepo(t, false)
+	head := commitTestFiles(t, src, map[string]string{"file": "content"}, "first")
+	dir, err := ioutil.TempDir("", "git2-clone")
+	if err != nil {
+		cleanupSrc()
+		t.Fatal(err)
+	}
+	return src, head, filepath.Join(dir, "clone"), func() {
+		os.RemoveAll(dir)
+		cleanupSrc()
+	}
+}
+
+func checkCloneHead(t *testing.T, repo *Repository, want *Oid) {
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer head.Free()
+	if head.Oid().Compare(want) != 0 {
+		t.Errorf("HEAD is %s, want %s", head.Oid(), want)
+	}
+}
+
+func TestClone(t *testing.T) {
+	src, head, path, cleanup := createCloneSource(t)
+	defer cleanup()
+
+	repo, err := Clone(src.Workdir(), path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Free()
+
+	checkCloneHead(t, repo, head)
+	data, err := ioutil.ReadFile(filepath.Join(path, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "content" {
+		t.Errorf("file holds %q, want %q", data, "content")
+	}
+	remotes, err := repo.ListRemotes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remotes) != 1 || remotes[0] != "origin" {
+		t.Errorf("remotes are %v, want [origin]", remotes)
+	}
+}
+
+func TestCloneBareWithRemoteName(t *testing.T) {
+	src, head, path, cleanup := createCloneSource(t)
+	defer cleanup()
+
+	repo, err := Clone(src.Workdir(), path, &CloneOptions{Bare: true, RemoteName: "upstream"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Free()
+
+	if !repo.Bare() {
+		t.Error("the clone is not bare")
+	}
+	checkCloneHead(t, repo, head)
+	remotes, err := repo.ListRemotes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remotes) != 1 || remotes[0] != "upstream" {
+		t.Errorf("remotes are %v, want [upstream]", remotes)
+	}
+}
+
+func TestCloneRemoteCreateCallback(t *testing.T) {
+	src, head, path, cleanup := createCloneSource(t)
+	defer cleanup()
+
+	var gotName, gotUrl string
+	opts := &CloneOptions{
+		RemoteCreateCallback: func(repo *Repository, name, url string, payload interface{}) (*Remote, error) {
+			gotName, gotUrl = name, url
+			return repo.AddRemote(name, url)
+		},
+	}
+	repo, err := Clone(src.Workdir(), path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Free()
+
+	if gotName != "origin" || gotUrl != src.Workdir() {
+		t.Errorf("callback called with %q, %q", gotName, gotUrl)
+	}
+	checkCloneHead(t, repo, head)
+}
+
+func TestCloneRemoteCreateCallbackFailure(t *testing.T) {
+	src, _, path, cleanup := createCloneSource(t)
+	defer cleanup()
+
+	callbacks := map[string]RemoteCreateCallback{
+		"error": func(repo *Repository, name, url string, payload interface{}) (*Remote, error) {
+			return nil, errors.New("no remote for you")
+		},
+		"nil remote": func(repo *Repository, name, url string, payload interface{}) (*Remote, error) {
+			return nil, nil
+		},
+	}
+	for desc, callback := range callbacks {
+		repo, err := Clone(src.Workdir(), path, &CloneOptions{RemoteCreateCallback: callback})
+		if err == nil {
+			repo.Free()
+			t.Errorf("%s: clone succeeded", desc)
+		}
+		os.RemoveAll(path)
+	}
+}
+
+func TestCloneCheckoutBranch(t *testing.T) {
+	src, _, path, cleanup := createCloneSource(t)
+	defer cleanup()
+	feature := commitTestFiles(t, src, map[string]string{"file": "feature"}, "feature")
+	target, err := src.LookupObject(feature, OBJ_COMMIT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Free()
+	if _, err = src.CreateBranch("feature", target, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Going through the remote create callback path as well.
+	var updated []string
+	opts := &CloneOptions{
+		RemoteName:     "upstream",
+		CheckoutBranch: "feature",
+		Callbacks: &RemoteCallbacks{
+			UpdateTips: func(refname string, oldId, newId *Oid, payload interface{}) error {
+				updated = append(updated, refname)
+				return nil
+			},
+		},
+	}
+	repo, err := Clone(src.Workdir(), path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Free()
+
+	checkCloneHead(t, repo, feature)
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer head.Free()
+	if head.Name() != "refs/heads/feature" {
+		t.Errorf("HEAD is at %s", head.Name())
+	}
+	data, err := ioutil.ReadFile(filepath.Join(path, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "feature" {
+		t.Errorf("file holds %q", data)
+	}
+	if len(updated) == 0 {
+		t.Error("the UpdateTips callback was not called")
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.Free()
+	if remote, err := cfg.GetString("branch.feature.remote"); err != nil || remote != "upstream" {
+		t.Errorf("branch.feature.remote is %q, %v", remote, err)
+	}
+}
+
+func TestCloneMissingBranch(t *testing.T) {
+	src, _, path, cleanup := createCloneSource(t)
+	defer cleanup()
+
+	for _, name := range []string{"", "upstream"} {
+		repo, err := Clone(src.Workdir(), path, &CloneOptions{RemoteName: name, CheckoutBranch: "missing"})
+		if err == nil {
+			repo.Free()
+			t.Errorf("remote %q: cloned a missing branch", name)
+		}
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("remote %q: the failed clone was left behind: %v", name, err)
+		}
+		os.RemoveAll(path)
+	}
+}
@@ -62,7 +62,7 @@ func (commit *Commit) Parent(n uint) (*Commit, error) {
 
 func (commit *Commit) ParentOid(n uint) (*Oid, error) {
 	poid := new(Oid)
-	poid.git_oid = C.git_commit_parent_oid(commit.git_commit, C.uint(n))
+	poid.git_oid = C.git_commit_parent_id(commit.git_commit, C.uint(n))
 	if poid.git_oid == nil {
 		return nil, gitError()
 	}
@@ -90,7 +90,7 @@ func (commit *Commit) Tree() (*Tree, error) {
 
 func (commit *Commit) TreeOid() (*Oid, error) {
 	toid := new(Oid)
-	toid.git_oid = C.git_commit_tree_oid(commit.git_commit)
+	toid.git_oid = C.git_commit_tree_id(commit.git_commit)
 	if toid.git_oid == nil {
 		return nil, gitError()
 	}
@@ -137,7 +137,7 @@ func (repo *Repository) LookupCommit(oid *Oid) (*Commit, error) {
 
 func (repo *Repository) LookupCommitPrefix(oid *Oid, n uint) (*Commit, error) {
 	commit := new(Commit)
-	ecode := C.git_commit_lookup_prefix(&commit.git_commit, repo.git_repository, oid.git_oid, C.unsigned(n))
+	ecode := C.git_commit_lookup_prefix(&commit.git_commit, repo.git_repository, oid.git_oid, C.size_t(n))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -2,13 +2,18 @@ package git2
 
 // #cgo pkg-config: libgit2
 // #include <git2.h>
+// #if LIBGIT2_VER_MAJOR != 1 || LIBGIT2_VER_MINOR < 7
+// # error "libgit2 1.7 or a later 1.x release is required"
+// #endif
 import "C"
 import (
-	"errors"
+	"reflect"
+	"unsafe"
 )
 
 const (
-	git_SUCCESS = iota
+	git_SUCCESS   = iota
+	git_ENOTFOUND = -3
 )
 
 const (
@@ -30,17 +35,114 @@ func Version() (int, int, int) {
 	return int(cmajor), int(cminor), int(crev)
 }
 
-func Init() {
-	C.git_threads_init()
+// Initialise libgit2 and register the bundle transport for
+// BUNDLE_URL_PREFIX, see RegisterBundleTransport. Shutdown unregisters it.
+func Init() error {
+	C.git_libgit2_init()
+	return RegisterBundleTransport()
 }
 
 func Shutdown() {
-	C.git_threads_shutdown()
+	UnregisterTransport(BUNDLE_URL_PREFIX)
+	C.git_libgit2_shutdown()
+}
+
+// An error reported by libgit2. Code is the value the call returned where
+// it matters to callers, such as the not found code checked by IsNotFound.
+type GitError struct {
+	Message string
+	Class   int
+	Code    int
+}
+
+func (err *GitError) Error() string {
+	return err.Message
+}
+
+// Whether err is libgit2 reporting that what was asked for does not exist.
+func IsNotFound(err error) bool {
+	gitErr, ok := err.(*GitError)
+	return ok && gitErr.Code == git_ENOTFOUND
 }
 
 func gitError() error {
-	ge := C.giterr_last()
-	msg := C.GoString(ge.message)
-	C.giterr_clear()
-	return errors.New(msg)
+	return gitErrorCode(C.int(git_SUCCESS - 1))
+}
+
+func gitErrorCode(ecode C.int) error {
+	err := &GitError{Message: "git2: unknown error", Code: int(ecode)}
+	if ge := C.git_error_last(); ge != nil {
+		err.Message = C.GoString(ge.message)
+		err.Class = int(ge.klass)
+	}
+	C.git_error_clear()
+	return err
+}
+
+func makeCStrarray(strs []string) *C.git_strarray {
+	carray := new(C.git_strarray)
+	length := len(strs)
+	if length == 0 {
+		return carray
+	}
+	var ptr *C.char
+	carray.strings = (**C.char)(C.calloc(C.size_t(length), C.size_t(unsafe.Sizeof(ptr))))
+	carray.count = C.size_t(length)
+
+	// TODO: Find a safer way if one exists.
+	var stringsSlice reflect.SliceHeader
+	stringsSlice.Data = uintptr(unsafe.Pointer(carray.strings))
+	stringsSlice.Len = length
+	stringsSlice.Cap = length
+	cstrings := *(*[]*C.char)(unsafe.Pointer(&stringsSlice))
+
+	for i := 0; i < length; i++ {
+		cstrings[i] = C.CString(strs[i])
+	}
+	return carray
+}
+
+func freeCStrarray(carray *C.git_strarray) {
+	length := int(carray.count)
+	if length == 0 {
+		return
+	}
+
+	// TODO: Find a safer way if one exists.
+	var stringsSlice reflect.SliceHeader
+	stringsSlice.Data = uintptr(unsafe.Pointer(carray.strings))
+	stringsSlice.Len = length
+	stringsSlice.Cap = length
+	cstrings := *(*[]*C.char)(unsafe.Pointer(&stringsSlice))
+
+	for i := 0; i < length; i++ {
+		C.free(unsafe.Pointer(cstrings[i]))
+	}
+	C.free(unsafe.Pointer(carray.strings))
+	carray.strings = nil
+	carray.count = 0
+}
+
+func goStrings(carray *C.git_strarray) []string {
+	// TODO: Find a safer way if one exists.
+	var stringsSlice reflect.SliceHeader
+	length := int(carray.count)
+	stringsSlice.Data = uintptr(unsafe.Pointer(carray.strings))
+	stringsSlice.Len = length
+	stringsSlice.Cap = length
+	cstrings := *(*[]*C.char)(unsafe.Pointer(&stringsSlice))
+
+	strs := make([]string, length)
+	for i := 0; i < len(cstrings); i++ {
+		strs[i] = C.GoString(cstrings[i])
+	}
+	return strs
+}
+
+// Record err as libgit2's last error so it is reported to whoever called
+// into libgit2 when a Go callback fails.
+func setGitError(class C.int, err error) {
+	cmsg := C.CString(err.Error())
+	defer C.free(unsafe.Pointer(cmsg))
+	C.git_error_set_str(class, cmsg)
 }
@@ -1,20 +1,21 @@
 #include <git2.h>
+#include "_cgo_export.h"
 
-int go_cfg_foreach_callback2(const char *name, const char *value, void *payload) {
-	char *vname = (char *)name;
-	char *vvalue = (char *)value;
-	return go_cfg_foreach_callback(vname, vvalue, payload);
+int go_cfg_foreach_callback2(const git_config_entry *entry, void *payload) {
+	char *vname = (char *)entry->name;
+	char *vvalue = (char *)entry->value;
+	return go_cfg_foreach_callback(vname, vvalue, (uintptr_t)payload);
 }
 
-int goCfgForEach(git_config *cfg, void *payload) {
-	return git_config_foreach(cfg, go_cfg_foreach_callback2, payload);
+int goCfgForEach(git_config *cfg, uintptr_t payload) {
+	return git_config_foreach(cfg, go_cfg_foreach_callback2, (void *)payload);
 }
 
-int go_cfg_multivar_callback2(const char *value, void *data) {
-	char *vvalue = (char *)value;
-	return go_cfg_multivar_callback(vvalue, data);
+int go_cfg_multivar_callback2(const git_config_entry *entry, void *data) {
+	char *vvalue = (char *)entry->value;
+	return go_cfg_multivar_callback(vvalue, (uintptr_t)data);
 }
 
-int goCfgGetMultivar(git_config *cfg, const char *name, const char *regexp, void *data) {
-	return git_config_get_multivar(cfg, name, regexp, go_cfg_multivar_callback2, data);
+int goCfgGetMultivar(git_config *cfg, const char *name, const char *regexp, uintptr_t data) {
+	return git_config_get_multivar_foreach(cfg, name, regexp, go_cfg_multivar_callback2, (void *)data);
 }
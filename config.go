@@ -2,33 +2,33 @@ package git2
 
 // #cgo pkg-config: libgit2
 // #include <git2.h>
-// extern int go_cfg_foreach_callback(char *name, char *value, void *payload);
-// extern int goCfgForEach(git_config *cfg, void *payload);
-// extern int go_cfg_multivar_callback(char *value, void *data);
-// extern int goCfgGetMultivar(git_config *cfg, const char *name, const char *regexp, void *data);
+// extern int go_cfg_foreach_callback(char *name, char *value, uintptr_t payload);
+// extern int goCfgForEach(git_config *cfg, uintptr_t payload);
+// extern int go_cfg_multivar_callback(char *value, uintptr_t data);
+// extern int goCfgGetMultivar(git_config *cfg, const char *name, const char *regexp, uintptr_t data);
 import "C"
 import (
 	"unsafe"
 )
 
 func FindGlobalConfig() string {
-	var path [git_PATH_MAX]int8
-	cpath := (*C.char)(&path[0])
-	ecode := C.git_config_find_global(cpath, C.size_t(git_PATH_MAX))
+	var cpath C.git_buf
+	defer C.git_buf_dispose(&cpath)
+	ecode := C.git_config_find_global(&cpath)
 	if ecode != git_SUCCESS {
 		return ""
 	}
-	return C.GoString(cpath)
+	return C.GoString(cpath.ptr)
 }
 
 func FindSystemConfig() string {
-	var path [git_PATH_MAX]int8
-	cpath := (*C.char)(&path[0])
-	ecode := C.git_config_find_system(cpath, C.size_t(git_PATH_MAX))
+	var cpath C.git_buf
+	defer C.git_buf_dispose(&cpath)
+	ecode := C.git_config_find_system(&cpath)
 	if ecode != git_SUCCESS {
 		return ""
 	}
-	return C.GoString(cpath)
+	return C.GoString(cpath.ptr)
 }
 
 func OpenConfigOnDisk(path string) (*Config, error) {
@@ -43,8 +43,14 @@ func OpenConfigOnDisk(path string) (*Config, error) {
 }
 
 func OpenGlobalConfig() (*Config, error) {
+	var cpath C.git_buf
+	defer C.git_buf_dispose(&cpath)
+	ecode := C.git_config_find_global(&cpath)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
 	cfg := new(Config)
-	ecode := C.git_config_open_global(&cfg.git_config)
+	ecode = C.git_config_open_ondisk(&cfg.git_config, cpath.ptr)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -65,17 +71,13 @@ func NewConfig() (*Config, error) {
 }
 
 func (cfg *Config) AddFile(file *ConfigFile, priority int) error {
-	ecode := C.git_config_add_file(cfg.git_config, file.git_config_file, C.int(priority))
-	if ecode != git_SUCCESS {
-		return gitError()
-	}
-	return nil
+	return cfg.AddFileOnDisk(file.path, priority)
 }
 
 func (cfg *Config) AddFileOnDisk(path string, priority int) error {
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
-	ecode := C.git_config_add_file_ondisk(cfg.git_config, cpath, C.int(priority))
+	ecode := C.git_config_add_file_ondisk(cfg.git_config, cpath, C.git_config_level_t(priority), nil, C.int(c_FALSE))
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
@@ -85,7 +87,7 @@ func (cfg *Config) AddFileOnDisk(path string, priority int) error {
 func (cfg *Config) Delete(name string) error {
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	ecode := C.git_config_delete(cfg.git_config, cname)
+	ecode := C.git_config_delete_entry(cfg.git_config, cname)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
@@ -93,7 +95,8 @@ func (cfg *Config) Delete(name string) error {
 }
 
 func (cfg *Config) ForEach(callback ConfigForEachCallback, payload interface{}) error {
-	data := unsafe.Pointer(&cfgForEachCallbackWrapper{callback, payload})
+	data := trackCallback(&cfgForEachCallbackWrapper{callback, payload})
+	defer untrackCallback(data)
 	ecode := C.goCfgForEach(cfg.git_config, data)
 	if ecode != git_SUCCESS {
 		return gitError()
@@ -102,11 +105,10 @@ func (cfg *Config) ForEach(callback ConfigForEachCallback, payload interface{})
 }
 
 //export go_cfg_foreach_callback
-func go_cfg_foreach_callback(name, value *C.char, payload unsafe.Pointer) C.int {
-	wrap := (*cfgForEachCallbackWrapper)(payload)
+func go_cfg_foreach_callback(name, value *C.char, payload C.uintptr_t) C.int {
+	wrap := lookupCallback(payload).(*cfgForEachCallbackWrapper)
 	err := wrap.f(C.GoString(name), C.GoString(value), wrap.d)
 	if err != nil {
-		// In v0.17.0 this does nothing, I believe it is fixed in HEAD (as of 2013-03-05).
 		return C.int(git_SUCCESS - 1)
 	}
 	return C.int(git_SUCCESS)
@@ -129,7 +131,7 @@ func (cfg *Config) GetBool(name string) (bool, error) {
 	var cval C.int
 	ecode := C.git_config_get_bool(&cval, cfg.git_config, cname)
 	if ecode != git_SUCCESS {
-		return false, gitError()
+		return false, gitErrorCode(ecode)
 	}
 	return (cval != c_FALSE), nil
 }
@@ -154,7 +156,7 @@ func (cfg *Config) GetInt32(name string) (int32, error) {
 	var cval C.int32_t
 	ecode := C.git_config_get_int32(&cval, cfg.git_config, cname)
 	if ecode != git_SUCCESS {
-		return 0, gitError()
+		return 0, gitErrorCode(ecode)
 	}
 	return int32(cval), nil
 }
@@ -176,7 +178,7 @@ func (cfg *Config) GetInt64(name string) (int64, error) {
 	var cval C.int64_t
 	ecode := C.git_config_get_int64(&cval, cfg.git_config, cname)
 	if ecode != git_SUCCESS {
-		return 0, gitError()
+		return 0, gitErrorCode(ecode)
 	}
 	return int64(cval), nil
 }
@@ -195,14 +197,13 @@ func (cfg *Config) SetInt64(name string, value int64) error {
 func (cfg *Config) GetString(name string) (string, error) {
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	// TODO: Is there a better way to pass a string pointer to C?
-	var val [1]int8
-	cval := (*C.char)(&val[0])
-	ecode := C.git_config_get_string(&cval, cfg.git_config, cname)
+	var cval C.git_buf
+	defer C.git_buf_dispose(&cval)
+	ecode := C.git_config_get_string_buf(&cval, cfg.git_config, cname)
 	if ecode != git_SUCCESS {
-		return "", gitError()
+		return "", gitErrorCode(ecode)
 	}
-	return C.GoString(cval), nil
+	return C.GoString(cval.ptr), nil
 }
 
 func (cfg *Config) SetString(name, value string) error {
@@ -218,7 +219,8 @@ func (cfg *Config) SetString(name, value string) error {
 }
 
 func (cfg *Config) GetMultivar(name, regexp string, callback ConfigMultivarCallback, data interface{}) error {
-	payload := unsafe.Pointer(&cfgMultivarCallbackWrapper{callback, data})
+	payload := trackCallback(&cfgMultivarCallbackWrapper{callback, data})
+	defer untrackCallback(payload)
 	var cname *C.char
 	// Treat an empty string as nil(NULL); avoids using regex in libgit2
 	if name != "" {
@@ -235,8 +237,8 @@ func (cfg *Config) GetMultivar(name, regexp string, callback ConfigMultivarCallb
 }
 
 //export go_cfg_multivar_callback
-func go_cfg_multivar_callback(value *C.char, data unsafe.Pointer) C.int {
-	wrap := (*cfgMultivarCallbackWrapper)(data)
+func go_cfg_multivar_callback(value *C.char, data C.uintptr_t) C.int {
+	wrap := lookupCallback(data).(*cfgMultivarCallbackWrapper)
 	err := wrap.f(C.GoString(value), wrap.d)
 	if err != nil {
 		return C.int(git_SUCCESS - 1)
@@ -265,20 +267,24 @@ func (cfg *Config) SetMultivar(name, regexp, value string) error {
 	return nil
 }
 
+func (cfg *Config) DeleteMultivar(name, regexp string) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	cregexp := C.CString(regexp)
+	defer C.free(unsafe.Pointer(cregexp))
+	ecode := C.git_config_delete_multivar(cfg.git_config, cname, cregexp)
+	if ecode != git_SUCCESS {
+		return gitErrorCode(ecode)
+	}
+	return nil
+}
+
+// A configuration file on disk, to be added to a Config. libgit2 no longer
+// exposes its file backend, the file is only opened by Config.AddFile.
 type ConfigFile struct {
-	git_config_file *C.git_config_file
+	path string
 }
 
 func NewConfigFile(path string) (*ConfigFile, error) {
-	cfgFile := new(ConfigFile)
-	cpath := C.CString(path)
-	defer C.free(unsafe.Pointer(cpath))
-	// libgit2 awkwardly uses a struct here, we cast it later
-	var cfgFileStruct *C.struct_git_config_file
-	ecode := C.git_config_file__ondisk(&cfgFileStruct, cpath)
-	if ecode != git_SUCCESS {
-		return nil, gitError()
-	}
-	cfgFile.git_config_file = (*C.git_config_file)(cfgFileStruct)
-	return cfgFile, nil
+	return &ConfigFile{path}, nil
 }
@@ -0,0 +1,215 @@
+package git2
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// The attributes exchanged with git's credential helpers, see
+// git-credential(1).
+type CredentialDescription struct {
+	Protocol string
+	Host     string
+	Path     string
+	Username string
+	Password string
+}
+
+// Describe the credentials needed for rawurl, keeping the username from
+// the URL if it has one.
+func NewCredentialDescription(rawurl string) (*CredentialDescription, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	desc := &CredentialDescription{
+		Protocol: u.Scheme,
+		Host:     u.Host,
+		Path:     strings.TrimPrefix(u.Path, "/"),
+	}
+	if u.User != nil {
+		desc.Username = u.User.Username()
+	}
+	return desc, nil
+}
+
+func (desc *CredentialDescription) encode() []byte {
+	var buf bytes.Buffer
+	attrs := []struct{ key, value string }{
+		{"protocol", desc.Protocol},
+		{"host", desc.Host},
+		{"path", desc.Path},
+		{"username", desc.Username},
+		{"password", desc.Password},
+	}
+	for _, attr := range attrs {
+		if attr.value != "" {
+			fmt.Fprintf(&buf, "%s=%s\n", attr.key, attr.value)
+		}
+	}
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+func (desc *CredentialDescription) decode(data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return errors.New("git2: malformed credential helper output: " + line)
+		}
+		key, value := line[:i], line[i+1:]
+		switch key {
+		case "protocol":
+			desc.Protocol = value
+		case "host":
+			desc.Host = value
+		case "path":
+			desc.Path = value
+		case "username":
+			desc.Username = value
+		case "password":
+			desc.Password = value
+		}
+	}
+	return scanner.Err()
+}
+
+// Runs "git credential <action>", which consults the helpers configured
+// with credential.helper.
+type CredentialHelper struct {
+	// The git executable, "git" from $PATH when empty.
+	Git string
+	// The description returned by the last successful Credentials call and
+	// the URL it was for, guarded by mu. With one helper shared between
+	// concurrent operations, ApproveLast and RejectLast act on whichever
+	// operation asked last.
+	mu        sync.Mutex
+	filled    *CredentialDescription
+	filledURL string
+}
+
+// Returned by CredentialHelper.Credentials when the server rejected the
+// credentials the helpers gave.
+var ErrCredentialsRejected = errors.New("git2: the credentials from the credential helper were rejected")
+
+func (helper *CredentialHelper) run(action string, desc *CredentialDescription) ([]byte, error) {
+	git := helper.Git
+	if git == "" {
+		git = "git"
+	}
+	cmd := exec.Command(git, "credential", action)
+	cmd.Stdin = bytes.NewReader(desc.encode())
+	// Never fall back to prompting on a terminal.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, errors.New("git2: git credential " + action + ": " + msg)
+	}
+	return out, nil
+}
+
+func (helper *CredentialHelper) Fill(desc *CredentialDescription) (*CredentialDescription, error) {
+	out, err := helper.run("fill", desc)
+	if err != nil {
+		return nil, err
+	}
+	filled := *desc
+	if err = filled.decode(out); err != nil {
+		return nil, err
+	}
+	return &filled, nil
+}
+
+func (helper *CredentialHelper) Approve(desc *CredentialDescription) error {
+	_, err := helper.run("approve", desc)
+	return err
+}
+
+func (helper *CredentialHelper) Reject(desc *CredentialDescription) error {
+	_, err := helper.run("reject", desc)
+	return err
+}
+
+// A CredentialsCallback asking the configured helpers for a username and
+// password. libgit2 only asks again for the same URL when the server
+// rejected the credentials, which are then rejected with the helpers and
+// the operation stopped with ErrCredentialsRejected. Call ApproveLast once
+// the operation succeeds so the helpers can store them, or RejectLast when
+// it fails otherwise.
+func (helper *CredentialHelper) Credentials(rawurl, usernameFromURL string, allowed CredType, payload interface{}) (*Credential, error) {
+	if allowed&CREDTYPE_USERPASS_PLAINTEXT == 0 {
+		return nil, nil
+	}
+	helper.mu.Lock()
+	var rejected *CredentialDescription
+	if helper.filled != nil && helper.filledURL == rawurl {
+		rejected, helper.filled = helper.filled, nil
+	}
+	helper.mu.Unlock()
+	if rejected != nil {
+		if err := helper.Reject(rejected); err != nil {
+			return nil, err
+		}
+		return nil, ErrCredentialsRejected
+	}
+	desc, err := NewCredentialDescription(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if usernameFromURL != "" {
+		desc.Username = usernameFromURL
+	}
+	filled, err := helper.Fill(desc)
+	if err != nil {
+		return nil, err
+	}
+	helper.mu.Lock()
+	helper.filled = filled
+	helper.filledURL = rawurl
+	helper.mu.Unlock()
+	return NewCredUserpassPlaintext(filled.Username, filled.Password)
+}
+
+// Take the last filled description, so that it is approved or rejected
+// only once.
+func (helper *CredentialHelper) takeLast() *CredentialDescription {
+	helper.mu.Lock()
+	defer helper.mu.Unlock()
+	filled := helper.filled
+	helper.filled = nil
+	return filled
+}
+
+func (helper *CredentialHelper) ApproveLast() error {
+	filled := helper.takeLast()
+	if filled == nil {
+		return nil
+	}
+	return helper.Approve(filled)
+}
+
+func (helper *CredentialHelper) RejectLast() error {
+	filled := helper.takeLast()
+	if filled == nil {
+		return nil
+	}
+	return helper.Reject(filled)
+}
@@ -0,0 +1,186 @@
+package git2
+
+// #cgo pkg-config: libgit2
+// #include <git2.h>
+// #include <git2/sys/credential.h>
+import "C"
+import (
+	"errors"
+	"sync"
+	"unsafe"
+)
+
+const (
+	git_PASSTHROUGH = -30
+)
+
+type CredType uint
+
+const (
+	CREDTYPE_USERPASS_PLAINTEXT CredType = 1 << iota
+	CREDTYPE_SSH_KEY
+	CREDTYPE_SSH_CUSTOM
+	CREDTYPE_DEFAULT
+	CREDTYPE_SSH_INTERACTIVE
+	CREDTYPE_USERNAME
+	CREDTYPE_SSH_MEMORY
+)
+
+// Credentials handed back to libgit2 from a CredentialsCallback. Once
+// returned from the callback libgit2 owns the credential and frees it.
+type Credential struct {
+	git_credential *C.git_credential
+}
+
+func (cred *Credential) Free() {
+	C.git_credential_free(cred.git_credential)
+}
+
+func (cred *Credential) HasUsername() bool {
+	return C.git_credential_has_username(cred.git_credential) != c_FALSE
+}
+
+func (cred *Credential) Type() CredType {
+	return CredType(cred.git_credential.credtype)
+}
+
+func NewCredUserpassPlaintext(username, password string) (*Credential, error) {
+	cred := new(Credential)
+	cusername := C.CString(username)
+	defer C.free(unsafe.Pointer(cusername))
+	cpassword := C.CString(password)
+	defer C.free(unsafe.Pointer(cpassword))
+	ecode := C.git_credential_userpass_plaintext_new(&cred.git_credential, cusername, cpassword)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return cred, nil
+}
+
+// An empty publicKeyPath lets libgit2 derive the public key from the
+// private one.
+func NewCredSshKey(username, publicKeyPath, privateKeyPath, passphrase string) (*Credential, error) {
+	cred := new(Credential)
+	cusername := C.CString(username)
+	defer C.free(unsafe.Pointer(cusername))
+	var cpublicKeyPath *C.char
+	if publicKeyPath != "" {
+		cpublicKeyPath = C.CString(publicKeyPath)
+		defer C.free(unsafe.Pointer(cpublicKeyPath))
+	}
+	cprivateKeyPath := C.CString(privateKeyPath)
+	defer C.free(unsafe.Pointer(cprivateKeyPath))
+	cpassphrase := C.CString(passphrase)
+	defer C.free(unsafe.Pointer(cpassphrase))
+	ecode := C.git_credential_ssh_key_new(&cred.git_credential, cusername, cpublicKeyPath, cprivateKeyPath, cpassphrase)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return cred, nil
+}
+
+func NewCredSshKeyFromMemory(username, publicKey, privateKey, passphrase string) (*Credential, error) {
+	cred := new(Credential)
+	cusername := C.CString(username)
+	defer C.free(unsafe.Pointer(cusername))
+	var cpublicKey *C.char
+	if publicKey != "" {
+		cpublicKey = C.CString(publicKey)
+		defer C.free(unsafe.Pointer(cpublicKey))
+	}
+	cprivateKey := C.CString(privateKey)
+	defer C.free(unsafe.Pointer(cprivateKey))
+	cpassphrase := C.CString(passphrase)
+	defer C.free(unsafe.Pointer(cpassphrase))
+	ecode := C.git_credential_ssh_key_memory_new(&cred.git_credential, cusername, cpublicKey, cprivateKey, cpassphrase)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return cred, nil
+}
+
+func NewCredSshKeyFromAgent(username string) (*Credential, error) {
+	cred := new(Credential)
+	cusername := C.CString(username)
+	defer C.free(unsafe.Pointer(cusername))
+	ecode := C.git_credential_ssh_key_from_agent(&cred.git_credential, cusername)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return cred, nil
+}
+
+// Credentials for NTLM or Negotiate authentication using the current
+// user's login.
+func NewCredDefault() (*Credential, error) {
+	cred := new(Credential)
+	ecode := C.git_credential_default_new(&cred.git_credential)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return cred, nil
+}
+
+// Only a username, used when SSH asks for the user before the key.
+func NewCredUsername(username string) (*Credential, error) {
+	cred := new(Credential)
+	cusername := C.CString(username)
+	defer C.free(unsafe.Pointer(cusername))
+	ecode := C.git_credential_username_new(&cred.git_credential, cusername)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return cred, nil
+}
+
+// Called when the remote asks for authentication. allowed holds the
+// credential types the server accepts, usernameFromURL is empty when the
+// URL does not contain one.
+type CredentialsCallback func(url, usernameFromURL string, allowed CredType, payload interface{}) (*Credential, error)
+
+var ErrCredentialsRetryLimit = errors.New("git2: too many authentication attempts")
+
+// Counts the credentials asked for per URL, failing with
+// ErrCredentialsRetryLimit once a URL has been asked for more than Limit
+// times; libgit2 asks again for as long as the server rejects the
+// credentials. Its Credentials method may be used by several operations at
+// once.
+type CredentialsRetryLimiter struct {
+	Callback CredentialsCallback
+	Limit    int
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func NewCredentialsRetryLimiter(callback CredentialsCallback, limit int) *CredentialsRetryLimiter {
+	return &CredentialsRetryLimiter{Callback: callback, Limit: limit}
+}
+
+func (limiter *CredentialsRetryLimiter) Credentials(url, usernameFromURL string, allowed CredType, payload interface{}) (*Credential, error) {
+	limiter.mu.Lock()
+	if limiter.attempts == nil {
+		limiter.attempts = make(map[string]int)
+	}
+	limiter.attempts[url]++
+	exceeded := limiter.attempts[url] > limiter.Limit
+	limiter.mu.Unlock()
+	if exceeded {
+		return nil, ErrCredentialsRetryLimit
+	}
+	return limiter.Callback(url, usernameFromURL, allowed, payload)
+}
+
+// Forget the attempts made for url, to be called once an operation on it
+// has finished.
+func (limiter *CredentialsRetryLimiter) Reset(url string) {
+	limiter.mu.Lock()
+	delete(limiter.attempts, url)
+	limiter.mu.Unlock()
+}
+
+// Wrap callback in a CredentialsRetryLimiter of its own. As nothing resets
+// it after a successful operation, make one for each operation.
+func CredentialsWithRetryLimit(callback CredentialsCallback, limit int) CredentialsCallback {
+	return NewCredentialsRetryLimiter(callback, limit).Credentials
+}
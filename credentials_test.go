@@ -0,0 +1,125 @@
+package git2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCredentialsRetryLimiter(t *testing.T) {
+	limiter := NewCredentialsRetryLimiter(func(url, usernameFromURL string, allowed CredType, payload interface{}) (*Credential, error) {
+		return nil, nil
+	}, 2)
+
+	for i := 0; i < 2; i++ {
+		if _, err := limiter.Credentials("https://a.example/repo", "", CREDTYPE_USERPASS_PLAINTEXT, nil); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+	if _, err := limiter.Credentials("https://b.example/repo", "", CREDTYPE_USERPASS_PLAINTEXT, nil); err != nil {
+		t.Errorf("another URL: %v", err)
+	}
+	if _, err := limiter.Credentials("https://a.example/repo", "", CREDTYPE_USERPASS_PLAINTEXT, nil); err != ErrCredentialsRetryLimit {
+		t.Errorf("attempt 3 gave %v, want ErrCredentialsRetryLimit", err)
+	}
+
+	limiter.Reset("https://b.example/repo")
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := limiter.Credentials("https://b.example/repo", "", CREDTYPE_USERPASS_PLAINTEXT, nil)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	failed := 0
+	for err := range errs {
+		if err == ErrCredentialsRetryLimit {
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Errorf("%d of 4 concurrent attempts hit the limit, want 2", failed)
+	}
+}
+
+// A stand-in for git logging the credential actions it is asked for.
+func createFakeGit(t *testing.T) (string, string, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake git is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "git2-credential")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "log")
+	script := "#!/bin/sh\n" +
+		"echo \"$2\" >> " + log + "\n" +
+		"cat > /dev/null\n" +
+		"if [ \"$2\" = fill ]; then printf 'username=user\\npassword=secret\\n\\n'; fi\n"
+	git := filepath.Join(dir, "git")
+	if err = ioutil.WriteFile(git, []byte(script), 0755); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return git, log, func() { os.RemoveAll(dir) }
+}
+
+func TestCredentialHelperRejectsAndStops(t *testing.T) {
+	git, log, cleanup := createFakeGit(t)
+	defer cleanup()
+	helper := &CredentialHelper{Git: git}
+	url := "https://example.com/repo.git"
+
+	cred, err := helper.Credentials(url, "", CREDTYPE_USERPASS_PLAINTEXT, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred.Free()
+	// Asked again for the same URL, the server turned the credentials down.
+	if _, err = helper.Credentials(url, "", CREDTYPE_USERPASS_PLAINTEXT, nil); err != ErrCredentialsRejected {
+		t.Fatalf("second attempt gave %v, want ErrCredentialsRejected", err)
+	}
+
+	data, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actions := strings.Fields(string(data)); strings.Join(actions, " ") != "fill reject" {
+		t.Errorf("git credential was run with %v, want [fill reject]", actions)
+	}
+}
+
+func TestCredentialHelperApprove(t *testing.T) {
+	git, log, cleanup := createFakeGit(t)
+	defer cleanup()
+	helper := &CredentialHelper{Git: git}
+	url := "https://example.com/repo.git"
+
+	for i := 0; i < 2; i++ {
+		cred, err := helper.Credentials(url, "", CREDTYPE_USERPASS_PLAINTEXT, nil)
+		if err != nil {
+			t.Fatalf("operation %d: %v", i+1, err)
+		}
+		cred.Free()
+		if err = helper.ApproveLast(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actions := strings.Join(strings.Fields(string(data)), " "); actions != "fill approve fill approve" {
+		t.Errorf("git credential was run with %q", actions)
+	}
+}
@@ -0,0 +1,204 @@
+package git2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DAEMON_DEFAULT_PORT = 9418
+
+// Serves git-upload-pack over the git:// protocol, read-only like git
+// daemon with its default services. Fetching from a git:// URL needs
+// nothing on the client side, libgit2 speaks the protocol itself.
+type Daemon struct {
+	// Directory the paths requested by clients are resolved against.
+	BasePath string
+	// Serve every repository, not only those containing a
+	// git-daemon-export-ok file.
+	ExportAll bool
+	// When not empty, only repositories at or below these directories,
+	// relative to BasePath, are served.
+	Whitelist []string
+	// When set, called with the path of the repository relative to
+	// BasePath and the client's address, an error refuses the client.
+	Access func(path string, remote net.Addr) error
+	// Connections idle for longer than this are dropped, zero disables
+	// the timeout.
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// Listen on addr, ":9418" when empty, and serve until Close is called.
+func (d *Daemon) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = fmt.Sprintf(":%d", DAEMON_DEFAULT_PORT)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return d.Serve(l)
+}
+
+// Serve the connections accepted on l until Close is called.
+func (d *Daemon) Serve(l net.Listener) error {
+	d.mu.Lock()
+	d.listener = l
+	d.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			d.mu.Lock()
+			closed := d.listener == nil
+			d.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		go d.serveConn(conn)
+	}
+}
+
+func (d *Daemon) Close() error {
+	d.mu.Lock()
+	l := d.listener
+	d.listener = nil
+	d.mu.Unlock()
+	if l == nil {
+		return nil
+	}
+	return l.Close()
+}
+
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *timeoutConn) Read(b []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(b)
+}
+
+// A client which stops reading would otherwise block the pack forever.
+func (c *timeoutConn) Write(b []byte) (int, error) {
+	c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(b)
+}
+
+func (d *Daemon) serveConn(conn net.Conn) {
+	defer conn.Close()
+	if d.Timeout > 0 {
+		conn = &timeoutConn{conn, d.Timeout}
+	}
+	br := bufio.NewReader(conn)
+
+	// The request is a single pkt-line:
+	// "git-upload-pack /path\0host=example.com\0".
+	line, err := readPkt(br)
+	if err != nil || line == nil {
+		return
+	}
+	request := strings.TrimSuffix(string(line), "\n")
+	space := strings.IndexByte(request, ' ')
+	if space < 0 {
+		writePktString(conn, "ERR malformed request\n")
+		return
+	}
+	service := request[:space]
+	path := strings.SplitN(request[space+1:], "\x00", 2)[0]
+	if service != SERVICE_UPLOADPACK.String() {
+		writePktString(conn, "ERR service not enabled: %s\n", service)
+		return
+	}
+
+	repo, err := d.openRepository(path, conn.RemoteAddr())
+	if err != nil {
+		writePktString(conn, "ERR %s\n", err)
+		return
+	}
+	defer repo.Free()
+
+	if err = repo.AdvertiseRefs(conn, SERVICE_UPLOADPACK); err != nil {
+		return
+	}
+	repo.UploadPack(br, conn, false)
+}
+
+var errDaemonNoRepository = errors.New("access denied or repository not exported")
+
+// Open the repository a client asked for, checking it may be served. To
+// avoid telling which repositories exist, refusals all look alike.
+func (d *Daemon) openRepository(path string, remote net.Addr) (*Repository, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, errDaemonNoRepository
+	}
+	for _, component := range strings.Split(path, "/") {
+		if component == ".." {
+			return nil, errDaemonNoRepository
+		}
+	}
+	rel := filepath.Clean(strings.TrimPrefix(path, "/"))
+
+	if len(d.Whitelist) > 0 {
+		allowed := false
+		for _, dir := range d.Whitelist {
+			dir = filepath.Clean(dir)
+			if dir == "." || rel == dir || strings.HasPrefix(rel, dir+"/") {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, errDaemonNoRepository
+		}
+	}
+	if d.Access != nil {
+		if err := d.Access(rel, remote); err != nil {
+			return nil, err
+		}
+	}
+
+	// Like git daemon, "/project" also finds project.git and the
+	// repository of a working directory.
+	full := filepath.Join(d.BasePath, rel)
+	var repo *Repository
+	for _, candidate := range []string{full + ".git/.git", full + "/.git", full + ".git", full} {
+		if _, err := os.Stat(candidate); err != nil {
+			continue
+		}
+		var err error
+		if repo, err = Open(candidate); err == nil {
+			break
+		}
+	}
+	if repo == nil {
+		return nil, errDaemonNoRepository
+	}
+
+	if !d.ExportAll {
+		if _, err := os.Stat(filepath.Join(repo.Path(), "git-daemon-export-ok")); err != nil {
+			repo.Free()
+			return nil, errDaemonNoRepository
+		}
+	}
+	if cfg, err := repo.Config(); err == nil {
+		enabled, err := cfg.GetBool("daemon.uploadpack")
+		cfg.Free()
+		if err == nil && !enabled {
+			repo.Free()
+			return nil, errDaemonNoRepository
+		}
+	}
+	return repo, nil
+}
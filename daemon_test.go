@@ -0,0 +1,139 @@
+package git2
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A base directory holding an exported repository "public", an unexported
+// one "private" and an exported one "team/project".
+func createDaemonBase(t *testing.T) (string, func()) {
+	base, err := ioutil.TempDir("", "git2-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"public", "private", "team/project"} {
+		repo, err := InitRepository(filepath.Join(base, name), false)
+		if err != nil {
+			os.RemoveAll(base)
+			t.Fatal(err)
+		}
+		commitTestFiles(t, repo, map[string]string{"file": name}, "first")
+		if name != "private" {
+			if err = ioutil.WriteFile(filepath.Join(repo.Path(), "git-daemon-export-ok"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		repo.Free()
+	}
+	return base, func() { os.RemoveAll(base) }
+}
+
+func checkDaemonAccess(t *testing.T, d *Daemon, path string, allowed bool) {
+	repo, err := d.openRepository(path, nil)
+	if err == nil {
+		repo.Free()
+	}
+	if allowed && err != nil {
+		t.Errorf("%s was refused: %v", path, err)
+	} else if !allowed && err == nil {
+		t.Errorf("%s was served", path)
+	}
+}
+
+func TestDaemonPathTraversal(t *testing.T) {
+	base, cleanup := createDaemonBase(t)
+	defer cleanup()
+	d := &Daemon{BasePath: filepath.Join(base, "team"), ExportAll: true}
+
+	checkDaemonAccess(t, d, "/project", true)
+	for _, path := range []string{"/../public", "/project/../../public", "/./../public", "project", "/.."} {
+		checkDaemonAccess(t, d, path, false)
+	}
+}
+
+func TestDaemonExportOk(t *testing.T) {
+	base, cleanup := createDaemonBase(t)
+	defer cleanup()
+
+	d := &Daemon{BasePath: base}
+	checkDaemonAccess(t, d, "/public", true)
+	checkDaemonAccess(t, d, "/team/project", true)
+	checkDaemonAccess(t, d, "/private", false)
+	checkDaemonAccess(t, d, "/missing", false)
+
+	d.ExportAll = true
+	checkDaemonAccess(t, d, "/private", true)
+}
+
+func TestDaemonWhitelist(t *testing.T) {
+	base, cleanup := createDaemonBase(t)
+	defer cleanup()
+
+	d := &Daemon{BasePath: base, ExportAll: true, Whitelist: []string{"team"}}
+	checkDaemonAccess(t, d, "/team/project", true)
+	checkDaemonAccess(t, d, "/public", false)
+	checkDaemonAccess(t, d, "/private", false)
+	// A prefix of the whitelisted directory name is not inside it.
+	d.Whitelist = []string{"pub"}
+	checkDaemonAccess(t, d, "/public", false)
+}
+
+func TestDaemonClone(t *testing.T) {
+	base, cleanup := createDaemonBase(t)
+	defer cleanup()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Daemon{BasePath: base, Timeout: time.Minute}
+	done := make(chan error, 1)
+	go func() { done <- d.Serve(l) }()
+	defer func() {
+		d.Close()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	dir, err := ioutil.TempDir("", "git2-daemon-clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	url := "git://" + l.Addr().String()
+
+	repo, err := Clone(url+"/public", filepath.Join(dir, "public"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "public", "file"))
+	repo.Free()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "public" {
+		t.Errorf("cloned file holds %q", data)
+	}
+
+	if repo, err = Clone(url+"/private", filepath.Join(dir, "private"), nil); err == nil {
+		repo.Free()
+		t.Error("cloned a repository which is not exported")
+	}
+}
+
+func TestDaemonWriteTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// Nothing reads from client, so the write must give up.
+	conn := &timeoutConn{server, 10 * time.Millisecond}
+	if _, err := conn.Write([]byte("0000")); err == nil {
+		t.Error("the write to a client which does not read succeeded")
+	}
+}
@@ -0,0 +1,473 @@
+package git2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What garbage collection must keep: the objects the references, their
+// reflogs and HEAD point at, and the blobs and cached trees of the index.
+type reachabilityRoots struct {
+	ids []*Oid
+	// Index blobs by path, which makes for better deltas when packing.
+	blobs map[string]*Oid
+}
+
+func (repo *Repository) reachabilityRoots() (*reachabilityRoots, error) {
+	roots := &reachabilityRoots{blobs: make(map[string]*Oid)}
+	names, err := repo.ListReferences(REF_LISTALL)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range append(names, "HEAD") {
+		ref, err := repo.LookupReference(name)
+		if err != nil {
+			continue
+		}
+		if id, err := repo.referenceTarget(ref); err == nil {
+			roots.ids = append(roots.ids, id)
+		}
+		if reflog, err := ref.ReadReflog(); err == nil {
+			for i := uint(0); i < reflog.Count(); i++ {
+				entry := reflog.EntryByIndex(i)
+				for _, id := range []*Oid{entry.OldOid(), entry.NewOid()} {
+					if id != nil && !id.IsZero() {
+						roots.ids = append(roots.ids, id.Copy())
+					}
+				}
+			}
+			reflog.Free()
+		}
+		ref.Free()
+	}
+
+	// Bare repositories have no index.
+	if index, err := repo.Index(); err == nil {
+		for i := uint(0); i < index.EntryCount(); i++ {
+			entry := index.Get(i)
+			roots.blobs[entry.Path()] = entry.Oid()
+		}
+		index.Free()
+
+		trees, err := indexCacheTrees(filepath.Join(repo.Path(), "index"))
+		if err != nil {
+			return nil, err
+		}
+		roots.ids = append(roots.ids, trees...)
+	}
+	return roots, nil
+}
+
+// The trees the cache-tree extension of the index file at path records.
+// libgit2 keeps them to itself, so the file is read directly.
+func indexCacheTrees(path string) ([]*Oid, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	malformed := errors.New("git2: malformed index " + path)
+	if len(data) < 12+git_OID_RAWSZ || string(data[:4]) != "DIRC" {
+		return nil, malformed
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	count := binary.BigEndian.Uint32(data[8:12])
+	// The file ends with its checksum.
+	end := len(data) - git_OID_RAWSZ
+
+	pos := 12
+	for i := uint32(0); i < count; i++ {
+		start := pos
+		// Stat data, id and flags, then the extended flags if any.
+		pos += 62
+		if pos > end {
+			return nil, malformed
+		}
+		if version >= 3 && binary.BigEndian.Uint16(data[pos-2:pos])&0x4000 != 0 {
+			pos += 2
+		}
+		if version >= 4 {
+			// The length of the prefix shared with the previous path.
+			for pos < end && data[pos]&0x80 != 0 {
+				pos++
+			}
+			pos++
+		}
+		if pos > end {
+			return nil, malformed
+		}
+		nul := bytes.IndexByte(data[pos:end], 0)
+		if nul < 0 {
+			return nil, malformed
+		}
+		pos += nul + 1
+		if version < 4 {
+			// Padded with NULs to a multiple of eight bytes.
+			pos = start + (pos-1-start+8)&^7
+		}
+	}
+
+	var trees []*Oid
+	for pos+8 <= end {
+		signature := string(data[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		pos += 8
+		if size > end-pos {
+			return nil, malformed
+		}
+		if signature == "TREE" {
+			if trees, err = parseCacheTree(data[pos : pos+size]); err != nil {
+				return nil, malformed
+			}
+		}
+		pos += size
+	}
+	return trees, nil
+}
+
+// Each cache-tree entry is "<path>\0<entries> <subtrees>\n" followed by the
+// tree's id, which is left out when <entries> is -1 to mark it invalid.
+func parseCacheTree(data []byte) ([]*Oid, error) {
+	var trees []*Oid
+	for len(data) > 0 {
+		nul := bytes.IndexByte(data, 0)
+		if nul < 0 {
+			return nil, errors.New("git2: malformed cache tree")
+		}
+		data = data[nul+1:]
+		newline := bytes.IndexByte(data, '\n')
+		if newline < 0 {
+			return nil, errors.New("git2: malformed cache tree")
+		}
+		fields := strings.Fields(string(data[:newline]))
+		data = data[newline+1:]
+		if len(fields) != 2 {
+			return nil, errors.New("git2: malformed cache tree")
+		}
+		entries, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		if entries < 0 {
+			continue
+		}
+		if len(data) < git_OID_RAWSZ {
+			return nil, errors.New("git2: malformed cache tree")
+		}
+		trees = append(trees, OidFromRaw(string(data[:git_OID_RAWSZ])))
+		data = data[git_OID_RAWSZ:]
+	}
+	return trees, nil
+}
+
+// Every object reachable from roots, keyed by id. Objects missing from the
+// repository, which a reflog may well point at, are left out.
+func (repo *Repository) reachableObjects(roots *reachabilityRoots) (map[string]bool, error) {
+	odb, err := repo.Odb()
+	if err != nil {
+		return nil, err
+	}
+	defer odb.Free()
+
+	reachable := make(map[string]bool)
+	pending := append([]*Oid(nil), roots.ids...)
+	for _, id := range roots.blobs {
+		pending = append(pending, id)
+	}
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if reachable[id.String()] {
+			continue
+		}
+		_, objType, err := odb.ReadHeader(id)
+		if err != nil {
+			continue
+		}
+		reachable[id.String()] = true
+
+		switch objType {
+		case OBJ_TAG:
+			tag, err := repo.LookupTag(id)
+			if err != nil {
+				return nil, err
+			}
+			pending = append(pending, tag.TargetOid().Copy())
+			tag.Free()
+		case OBJ_COMMIT:
+			commit, err := repo.LookupCommit(id)
+			if err != nil {
+				return nil, err
+			}
+			if tree, err := commit.TreeOid(); err == nil {
+				pending = append(pending, tree.Copy())
+			}
+			for n := uint(0); n < commit.ParentCount(); n++ {
+				if parent, err := commit.ParentOid(n); err == nil {
+					pending = append(pending, parent.Copy())
+				}
+			}
+			commit.Free()
+		case OBJ_TREE:
+			tree, err := repo.LookupTree(id)
+			if err != nil {
+				return nil, err
+			}
+			for i := uint(0); i < tree.EntryCount(); i++ {
+				entry := tree.EntryByIndex(i)
+				// Submodule commits live in another repository.
+				if entry.Type() != OBJ_COMMIT {
+					pending = append(pending, entry.Id().Copy())
+				}
+			}
+			tree.Free()
+		}
+	}
+	return reachable, nil
+}
+
+// Call callback with the id and path of every loose object.
+func (repo *Repository) forEachLooseObject(callback func(id, path string, info os.FileInfo) error) error {
+	objects := filepath.Join(repo.Path(), "objects")
+	dirs, err := ioutil.ReadDir(objects)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 || !isHex(dir.Name()) {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(objects, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if len(file.Name()) != git_OID_HEXSZ-2 || !isHex(file.Name()) {
+				continue
+			}
+			path := filepath.Join(objects, dir.Name(), file.Name())
+			if err = callback(dir.Name()+file.Name(), path, file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isHex(s string) bool {
+	return strings.Trim(s, "0123456789abcdef") == ""
+}
+
+type RepackOptions struct {
+	// Remove the packs and loose objects the new pack makes redundant,
+	// like git repack -a -d. Unreachable objects in the old packs are
+	// lost, packs with a .keep file are left alone.
+	DeleteRedundant bool
+	// Threads used to search for deltas, 0 meaning one per CPU.
+	Threads          uint
+	ProgressCallback PackBuilderProgressCallback
+	ProgressPayload  interface{}
+}
+
+// Write every reachable object, loose or packed, into a single new pack and
+// return its path, or "" when the repository holds nothing to pack.
+func (repo *Repository) Repack(opts *RepackOptions) (string, error) {
+	if opts == nil {
+		opts = new(RepackOptions)
+	}
+	roots, err := repo.reachabilityRoots()
+	if err != nil {
+		return "", err
+	}
+	odb, err := repo.Odb()
+	if err != nil {
+		return "", err
+	}
+	defer odb.Free()
+
+	pb, err := repo.NewPackBuilder()
+	if err != nil {
+		return "", err
+	}
+	defer pb.Free()
+	pb.SetThreads(opts.Threads)
+	if opts.ProgressCallback != nil {
+		if err = pb.SetProgressCallback(opts.ProgressCallback, opts.ProgressPayload); err != nil {
+			return "", err
+		}
+	}
+
+	walk, err := repo.NewRevwalk()
+	if err != nil {
+		return "", err
+	}
+	defer walk.Free()
+
+	walking := false
+	for _, id := range roots.ids {
+		_, objType, err := odb.ReadHeader(id)
+		if err != nil {
+			continue
+		}
+		if objType == OBJ_TAG {
+			if err = pb.InsertRecursive(id, ""); err != nil {
+				return "", err
+			}
+			if id = repo.peelTag(id); id == nil {
+				continue
+			}
+			if _, objType, err = odb.ReadHeader(id); err != nil {
+				continue
+			}
+		}
+		if objType == OBJ_COMMIT {
+			if err = walk.Push(id); err != nil {
+				return "", err
+			}
+			walking = true
+		} else if err = pb.InsertRecursive(id, ""); err != nil {
+			return "", err
+		}
+	}
+	if walking {
+		if err = pb.InsertWalk(walk); err != nil {
+			return "", err
+		}
+	}
+	for path, id := range roots.blobs {
+		if odb.Exists(id) {
+			if err = pb.Insert(id, path); err != nil {
+				return "", err
+			}
+		}
+	}
+	if pb.ObjectCount() == 0 {
+		return "", nil
+	}
+
+	dir := filepath.Join(repo.Path(), "objects", "pack")
+	if err = pb.WriteToDir(dir, 0, nil, nil); err != nil {
+		return "", err
+	}
+	packPath := filepath.Join(dir, "pack-"+pb.Hash().String()+".pack")
+	if opts.DeleteRedundant {
+		if err = repo.deleteRedundant(packPath); err != nil {
+			return packPath, err
+		}
+	}
+	return packPath, odb.Refresh()
+}
+
+// Remove every pack but packPath and the loose objects it holds.
+func (repo *Repository) deleteRedundant(packPath string) error {
+	pack, err := OpenPackfile(strings.TrimSuffix(packPath, ".pack") + ".idx")
+	if err != nil {
+		return err
+	}
+	packed := make(map[string]bool, len(pack.Entries))
+	for _, entry := range pack.Entries {
+		packed[entry.Id.String()] = true
+	}
+
+	oldPacks, err := filepath.Glob(filepath.Join(filepath.Dir(packPath), "pack-*.pack"))
+	if err != nil {
+		return err
+	}
+	for _, oldPack := range oldPacks {
+		base := strings.TrimSuffix(oldPack, ".pack")
+		if oldPack == packPath {
+			continue
+		}
+		if _, err = os.Stat(base + ".keep"); err == nil {
+			continue
+		}
+		if err = os.Remove(base + ".idx"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err = os.Remove(oldPack); err != nil {
+			return err
+		}
+	}
+
+	return repo.forEachLooseObject(func(id, path string, info os.FileInfo) error {
+		if !packed[id] {
+			return nil
+		}
+		return os.Remove(path)
+	})
+}
+
+// Remove the loose objects that are unreachable and older than expire,
+// returning their ids.
+func (repo *Repository) Prune(expire time.Duration) ([]*Oid, error) {
+	return repo.prune(expire, false)
+}
+
+// Report what Prune would remove, without removing anything.
+func (repo *Repository) PruneDryRun(expire time.Duration) ([]*Oid, error) {
+	return repo.prune(expire, true)
+}
+
+func (repo *Repository) prune(expire time.Duration, dryRun bool) ([]*Oid, error) {
+	roots, err := repo.reachabilityRoots()
+	if err != nil {
+		return nil, err
+	}
+	reachable, err := repo.reachableObjects(roots)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like git prune, keep what unreachable objects too recent to prune
+	// point at, or a tree written just before its commit would lose blobs.
+	cutoff := time.Now().Add(-expire)
+	recent := false
+	err = repo.forEachLooseObject(func(id, path string, info os.FileInfo) error {
+		if !reachable[id] && !info.ModTime().Before(cutoff) {
+			roots.ids = append(roots.ids, OidFromString(id))
+			recent = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if recent {
+		if reachable, err = repo.reachableObjects(roots); err != nil {
+			return nil, err
+		}
+	}
+
+	var pruned []*Oid
+	dirs := make(map[string]bool)
+	err = repo.forEachLooseObject(func(id, path string, info os.FileInfo) error {
+		if reachable[id] || !info.ModTime().Before(cutoff) {
+			return nil
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			dirs[filepath.Dir(path)] = true
+		}
+		pruned = append(pruned, OidFromString(id))
+		return nil
+	})
+	if err != nil {
+		return pruned, err
+	}
+	// Like git prune, drop the fan-out directories left empty; Remove fails
+	// on those that are not.
+	for dir := range dirs {
+		os.Remove(dir)
+	}
+	return pruned, nil
+}
@@ -0,0 +1,161 @@
+package git2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Backdate every loose object by age.
+func ageLooseObjects(t *testing.T, repo *Repository, age time.Duration) {
+	old := time.Now().Add(-age)
+	err := repo.forEachLooseObject(func(id, path string, info os.FileInfo) error {
+		return os.Chtimes(path, old, old)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkObjectsExist(t *testing.T, repo *Repository, ids ...*Oid) {
+	odb, err := repo.Odb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer odb.Free()
+	for _, id := range ids {
+		if !odb.Exists(id) {
+			t.Errorf("%v was pruned", id)
+		}
+	}
+}
+
+func TestPruneKeepsObjectsOfRecentObjects(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+
+	index, err := repo.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Free()
+	writeTestFile(t, repo, "kept", "kept\n")
+	if err = index.Add("kept", 0); err != nil {
+		t.Fatal(err)
+	}
+	treeId, err := index.CreateTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing references the tree once the index forgets it.
+	if err = index.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err = index.Write(); err != nil {
+		t.Fatal(err)
+	}
+	kept := testBlobId(t, repo, "kept\n")
+	lost := testBlobId(t, repo, "lost\n")
+	ageLooseObjects(t, repo, 2*time.Hour)
+
+	// A tree as recent as one being written for a commit.
+	treePath := filepath.Join(repo.Path(), "objects", treeId.String()[:2], treeId.String()[2:])
+	now := time.Now()
+	if err = os.Chtimes(treePath, now, now); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := repo.Prune(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0].Compare(lost) != 0 {
+		t.Fatalf("pruned %v, want only %v", pruned, lost)
+	}
+	checkObjectsExist(t, repo, treeId, kept)
+}
+
+func TestPruneKeepsCacheTrees(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+
+	index, err := repo.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Free()
+	for _, name := range []string{"a", "dir/b"} {
+		writeTestFile(t, repo, name, name+"\n")
+		if err = index.Add(name, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Writing the tree fills in the cache tree the index file records.
+	treeId, err := index.CreateTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = index.Write(); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := repo.LookupTree(treeId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Free()
+	entry := tree.EntryByName("dir")
+	if entry == nil {
+		t.Fatal("no dir in the tree")
+	}
+	dirId := entry.Id().Copy()
+
+	trees, err := indexCacheTrees(filepath.Join(repo.Path(), "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := make(map[string]bool)
+	for _, id := range trees {
+		cached[id.String()] = true
+	}
+	if len(trees) != 2 || !cached[treeId.String()] || !cached[dirId.String()] {
+		t.Fatalf("cache trees %v, want %v and %v", trees, treeId, dirId)
+	}
+
+	ageLooseObjects(t, repo, 2*time.Hour)
+	pruned, err := repo.Prune(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 0 {
+		t.Fatalf("pruned %v", pruned)
+	}
+	checkObjectsExist(t, repo, treeId, dirId)
+}
+
+func TestPruneUnreachable(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+
+	head := commitTestFiles(t, repo, map[string]string{"a": "a\n"}, "first")
+	lost := testBlobId(t, repo, "lost\n")
+	ageLooseObjects(t, repo, 2*time.Hour)
+
+	dryRun, err := repo.PruneDryRun(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dryRun) != 1 || dryRun[0].Compare(lost) != 0 {
+		t.Fatalf("dry run pruned %v, want only %v", dryRun, lost)
+	}
+	checkObjectsExist(t, repo, lost)
+
+	pruned, err := repo.Prune(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0].Compare(lost) != 0 {
+		t.Fatalf("pruned %v, want only %v", pruned, lost)
+	}
+	checkObjectsExist(t, repo, head)
+}
@@ -0,0 +1,141 @@
+package git2
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	if err := Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	Shutdown()
+	os.Exit(code)
+}
+
+// Create a repository in a temporary directory, removed along with the
+// repository by the returned function.
+func createTestRepo(t *testing.T, bare bool) (*Repository, func()) {
+	dir, err := ioutil.TempDir("", "git2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := InitRepository(dir, bare)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return repo, func() {
+		repo.Free()
+		os.RemoveAll(dir)
+	}
+}
+
+func testSignature(t *testing.T) *Signature {
+	sig, err := NewSignature("Test", "test@example.com", time.Unix(1400000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func writeTestFile(t *testing.T, repo *Repository, name, content string) {
+	path := filepath.Join(repo.Workdir(), name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Write files to the working directory, stage them and commit the index on
+// top of HEAD.
+func commitTestFiles(t *testing.T, repo *Repository, files map[string]string, message string) *Oid {
+	index, err := repo.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Free()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeTestFile(t, repo, name, files[name])
+		if err = index.Add(name, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = index.Write(); err != nil {
+		t.Fatal(err)
+	}
+	return commitTestIndex(t, repo, index, message)
+}
+
+// Commit index as it is on top of HEAD.
+func commitTestIndex(t *testing.T, repo *Repository, index *Index, message string) *Oid {
+	treeId, err := index.CreateTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := repo.LookupTree(treeId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Free()
+
+	var parents []*Commit
+	if head, err := repo.Head(); err == nil {
+		parent, err := repo.LookupCommit(head.Oid())
+		head.Free()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer parent.Free()
+		parents = append(parents, parent)
+	}
+
+	sig := testSignature(t)
+	defer sig.Free()
+	id, err := repo.CreateCommit("HEAD", sig, sig, "UTF-8", message, tree, parents...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// The id of the blob holding content, which is written to the repository.
+func testBlobId(t *testing.T, repo *Repository, content string) *Oid {
+	id, err := repo.CreateBlob([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// The staged paths and their blob ids.
+func testIndexEntries(t *testing.T, repo *Repository) map[string]string {
+	index, err := repo.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Free()
+	if err = index.Read(); err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]string)
+	for i := uint(0); i < index.EntryCount(); i++ {
+		entry := index.Get(i)
+		entries[entry.Path()] = entry.Oid().String()
+	}
+	return entries
+}
@@ -0,0 +1,146 @@
+// Package git2http serves repositories over the git smart HTTP protocol.
+package git2http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jgrocho/go-git2"
+)
+
+// Open the repository for the path of a request with the service suffix
+// removed, e.g. "/project.git". The handler frees the repository once the
+// request has been served.
+type Resolver func(path string) (*git2.Repository, error)
+
+type handler struct {
+	resolve Resolver
+	policy  git2.ReceivePolicy
+}
+
+// Serve clone, fetch and push for the repositories returned by resolve.
+// Only the smart protocol is spoken, dumb clients are refused.
+func NewHandler(resolve Resolver) http.Handler {
+	return &handler{resolve, nil}
+}
+
+// Like NewHandler, with policy deciding which reference updates of a push
+// are accepted.
+func NewPolicyHandler(resolve Resolver, policy git2.ReceivePolicy) http.Handler {
+	return &handler{resolve, policy}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/info/refs"):
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.serveInfoRefs(w, r, strings.TrimSuffix(r.URL.Path, "/info/refs"))
+	case strings.HasSuffix(r.URL.Path, "/git-upload-pack"):
+		h.serveService(w, r, strings.TrimSuffix(r.URL.Path, "/git-upload-pack"), git2.SERVICE_UPLOADPACK)
+	case strings.HasSuffix(r.URL.Path, "/git-receive-pack"):
+		h.serveService(w, r, strings.TrimSuffix(r.URL.Path, "/git-receive-pack"), git2.SERVICE_RECEIVEPACK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func parseService(name string) (git2.SmartService, bool) {
+	switch name {
+	case "git-upload-pack":
+		return git2.SERVICE_UPLOADPACK, true
+	case "git-receive-pack":
+		return git2.SERVICE_RECEIVEPACK, true
+	}
+	return 0, false
+}
+
+func noCache(w http.ResponseWriter) {
+	w.Header().Set("Expires", "Fri, 01 Jan 1980 00:00:00 GMT")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0, must-revalidate")
+}
+
+func (h *handler) open(w http.ResponseWriter, path string) *git2.Repository {
+	repo, err := h.resolve(path)
+	if err != nil || repo == nil {
+		http.Error(w, "repository not found", http.StatusNotFound)
+		return nil
+	}
+	return repo
+}
+
+func (h *handler) serveInfoRefs(w http.ResponseWriter, r *http.Request, path string) {
+	service, ok := parseService(r.URL.Query().Get("service"))
+	if !ok {
+		http.Error(w, "only the smart protocol is supported", http.StatusForbidden)
+		return
+	}
+	repo := h.open(w, path)
+	if repo == nil {
+		return
+	}
+	defer repo.Free()
+
+	// Build the advertisement first so a failure can still be reported
+	// with an error status.
+	var refs bytes.Buffer
+	if err := repo.AdvertiseRefs(&refs, service); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	noCache(w)
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-advertisement", service))
+	announcement := fmt.Sprintf("# service=%s\n", service)
+	fmt.Fprintf(w, "%04x%s0000", len(announcement)+4, announcement)
+	refs.WriteTo(w)
+}
+
+func (h *handler) serveService(w http.ResponseWriter, r *http.Request, path string, service git2.SmartService) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("Content-Type") != fmt.Sprintf("application/x-%s-request", service) {
+		http.Error(w, "unexpected content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	repo := h.open(w, path)
+	if repo == nil {
+		return
+	}
+	defer repo.Free()
+
+	noCache(w)
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-result", service))
+	var err error
+	if service == git2.SERVICE_UPLOADPACK {
+		err = repo.UploadPack(body, w, true)
+	} else {
+		err = repo.ReceivePack(body, w, h.policy)
+	}
+	// The response has already been started and, with side-band, the
+	// client told. Log the error like net/http logs its own.
+	if err != nil {
+		log.Printf("git2http: %s %s: %v", service, path, err)
+	}
+}
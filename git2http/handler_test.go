@@ -0,0 +1,248 @@
+package git2http
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jgrocho/go-git2"
+)
+
+func TestMain(m *testing.M) {
+	if err := git2.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	git2.Shutdown()
+	os.Exit(code)
+}
+
+// A repository with one commit, served by a handler which resolves every
+// path to it.
+func createServedRepo(t *testing.T) (*git2.Repository, *git2.Oid, Resolver, func()) {
+	dir, err := ioutil.TempDir("", "git2http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := git2.InitRepository(filepath.Join(dir, "repo"), false)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		repo.Free()
+		os.RemoveAll(dir)
+	}
+	if err = ioutil.WriteFile(filepath.Join(repo.Workdir(), "file"), []byte("content"), 0644); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	head, err := commitIndex(repo)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	resolve := func(path string) (*git2.Repository, error) {
+		if path != "/repo.git" {
+			return nil, errors.New("no such repository")
+		}
+		return git2.Open(repo.Path())
+	}
+	return repo, head, resolve, cleanup
+}
+
+func commitIndex(repo *git2.Repository) (*git2.Oid, error) {
+	index, err := repo.Index()
+	if err != nil {
+		return nil, err
+	}
+	defer index.Free()
+	if err = index.Add("file", 0); err != nil {
+		return nil, err
+	}
+	if err = index.Write(); err != nil {
+		return nil, err
+	}
+	treeId, err := index.CreateTree()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := repo.LookupTree(treeId)
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Free()
+	sig, err := git2.NewSignature("Test", "test@example.com", time.Unix(1400000000, 0))
+	if err != nil {
+		return nil, err
+	}
+	defer sig.Free()
+	return repo.CreateCommit("HEAD", sig, sig, "UTF-8", "first", tree)
+}
+
+func cloneDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "git2http-clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "clone"), func() { os.RemoveAll(dir) }
+}
+
+func TestCloneSelfSignedHTTPS(t *testing.T) {
+	_, head, resolve, cleanup := createServedRepo(t)
+	defer cleanup()
+	server := httptest.NewTLSServer(NewHandler(resolve))
+	defer server.Close()
+
+	path, cleanupClone := cloneDir(t)
+	defer cleanupClone()
+	var checked bool
+	opts := &git2.CloneOptions{
+		Callbacks: &git2.RemoteCallbacks{
+			CertificateCheck: func(cert *git2.Certificate, valid bool, hostname string, payload interface{}) error {
+				checked = true
+				if cert.Kind != git2.CERT_X509 || cert.X509 == nil {
+					t.Errorf("certificate of kind %d", cert.Kind)
+				} else if !cert.X509.Equal(server.Certificate()) {
+					t.Error("the callback was given another certificate")
+				}
+				if valid {
+					t.Error("the self-signed certificate was considered valid")
+				}
+				return nil
+			},
+		},
+	}
+	repo, err := git2.Clone(server.URL+"/repo.git", path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Free()
+	if !checked {
+		t.Error("the certificate check callback was not called")
+	}
+	ref, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Free()
+	if ref.Oid().Compare(head) != 0 {
+		t.Errorf("HEAD is %s, want %s", ref.Oid(), head)
+	}
+}
+
+func TestCloneSelfSignedHTTPSRejected(t *testing.T) {
+	_, _, resolve, cleanup := createServedRepo(t)
+	defer cleanup()
+	server := httptest.NewTLSServer(NewHandler(resolve))
+	defer server.Close()
+
+	path, cleanupClone := cloneDir(t)
+	defer cleanupClone()
+	opts := &git2.CloneOptions{
+		Callbacks: &git2.RemoteCallbacks{
+			CertificateCheck: func(cert *git2.Certificate, valid bool, hostname string, payload interface{}) error {
+				return errors.New("untrusted certificate")
+			},
+		},
+	}
+	if repo, err := git2.Clone(server.URL+"/repo.git", path, opts); err == nil {
+		repo.Free()
+		t.Fatal("cloned from a server whose certificate was rejected")
+	}
+
+	if repo, err := git2.Clone(server.URL+"/repo.git", path, &git2.CloneOptions{IgnoreCertErrors: true}); err != nil {
+		t.Errorf("IgnoreCertErrors: %v", err)
+	} else {
+		repo.Free()
+	}
+}
+
+func TestCloneHTTP(t *testing.T) {
+	_, head, resolve, cleanup := createServedRepo(t)
+	defer cleanup()
+	server := httptest.NewServer(NewHandler(resolve))
+	defer server.Close()
+
+	path, cleanupClone := cloneDir(t)
+	defer cleanupClone()
+	repo, err := git2.Clone(server.URL+"/repo.git", path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Free()
+	ref, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Free()
+	if ref.Oid().Compare(head) != 0 {
+		t.Errorf("HEAD is %s, want %s", ref.Oid(), head)
+	}
+
+	if missing, err := git2.Clone(server.URL+"/missing.git", path+"2", nil); err == nil {
+		missing.Free()
+		t.Error("cloned a repository the resolver does not know")
+	}
+}
+
+func TestFetchThroughProxyWithHeaders(t *testing.T) {
+	_, head, resolve, cleanup := createServedRepo(t)
+	defer cleanup()
+	// The proxy serves the repository itself, so the fetch only works when
+	// it goes through the proxy.
+	handler := NewHandler(resolve)
+	var proxied, headers int
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host == "git.invalid" {
+			proxied++
+		}
+		if r.Header.Get("X-Git2-Test") == "hello" {
+			headers++
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	path, cleanupClone := cloneDir(t)
+	defer cleanupClone()
+	repo, err := git2.InitRepository(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Free()
+	remote, err := repo.AddRemote("origin", "http://git.invalid/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Free()
+	opts := &git2.FetchOptions{
+		ProxyOptions: git2.ProxyOptions{Type: git2.PROXY_SPECIFIED, Url: proxy.URL},
+		Headers:      []string{"X-Git2-Test: hello"},
+	}
+	if err = remote.Fetch(nil, opts, ""); err != nil {
+		t.Fatal(err)
+	}
+	if proxied == 0 {
+		t.Error("no request went through the proxy")
+	}
+	if headers != proxied {
+		t.Errorf("%d of %d requests carried the header", headers, proxied)
+	}
+
+	odb, err := repo.Odb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer odb.Free()
+	if !odb.Exists(head) {
+		t.Errorf("commit %s was not fetched", head)
+	}
+}
@@ -0,0 +1,42 @@
+package git2
+
+// #include <stdint.h>
+import "C"
+import (
+	"sync"
+)
+
+// Handles for the Go values passed to libgit2 as callback payloads. Go
+// pointers cannot be kept in C memory, nor passed to C when they point at
+// other Go pointers, so C only ever sees the handle.
+var callbackHandles = struct {
+	sync.Mutex
+	next   uintptr
+	values map[uintptr]interface{}
+}{
+	values: make(map[uintptr]interface{}),
+}
+
+// Register value and return its handle, which must be released with
+// untrackCallback once libgit2 is done with it.
+func trackCallback(value interface{}) C.uintptr_t {
+	callbackHandles.Lock()
+	defer callbackHandles.Unlock()
+	callbackHandles.next++
+	handle := callbackHandles.next
+	callbackHandles.values[handle] = value
+	return C.uintptr_t(handle)
+}
+
+// The value registered as handle, nil once it has been released.
+func lookupCallback(handle C.uintptr_t) interface{} {
+	callbackHandles.Lock()
+	defer callbackHandles.Unlock()
+	return callbackHandles.values[uintptr(handle)]
+}
+
+func untrackCallback(handle C.uintptr_t) {
+	callbackHandles.Lock()
+	delete(callbackHandles.values, uintptr(handle))
+	callbackHandles.Unlock()
+}
@@ -4,6 +4,7 @@ package git2
 // #include <git2.h>
 import "C"
 import (
+	"errors"
 	"unsafe"
 )
 
@@ -22,10 +23,15 @@ type Index struct {
 	git_index *C.git_index
 }
 
+// Add the file at name, relative to the working directory. Files can only
+// be added at stage 0, conflicts are recorded by AddEntry.
 func (idx *Index) Add(name string, stage int) error {
+	if stage != 0 {
+		return errors.New("git2: files can only be added to the index at stage 0")
+	}
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	ecode := C.git_index_add(idx.git_index, cname, C.int(stage))
+	ecode := C.git_index_add_bypath(idx.git_index, cname)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
@@ -33,47 +39,83 @@ func (idx *Index) Add(name string, stage int) error {
 }
 
 func (idx *Index) AddEntry(entry *IndexEntry) error {
-	ecode := C.git_index_add2(idx.git_index, entry.git_index_entry)
+	ecode := C.git_index_add(idx.git_index, entry.git_index_entry)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
 	return nil
 }
 
+// The index no longer holds duplicate entries, Append is the same as Add.
 func (idx *Index) Append(name string, stage int) error {
-	cname := C.CString(name)
-	defer C.free(unsafe.Pointer(cname))
-	ecode := C.git_index_append(idx.git_index, cname, C.int(stage))
-	if ecode != git_SUCCESS {
-		return gitError()
-	}
-	return nil
+	return idx.Add(name, stage)
 }
 
+// The index no longer holds duplicate entries, AppendEntry is the same as
+// AddEntry.
 func (idx *Index) AppendEntry(entry *IndexEntry) error {
-	ecode := C.git_index_append2(idx.git_index, entry.git_index_entry)
+	return idx.AddEntry(entry)
+}
+
+func (idx *Index) Clear() error {
+	ecode := C.git_index_clear(idx.git_index)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
 	return nil
 }
 
-func (idx *Index) Clear() {
-	C.git_index_clear(idx.git_index)
-}
-
 func (idx *Index) EntryCount() uint {
 	return uint(C.git_index_entrycount(idx.git_index))
 }
 
 func (idx *Index) UnmergedEntryCount() uint {
-	return uint(C.git_index_entrycount_unmerged(idx.git_index))
+	var count uint
+	idx.forEachConflict(func(path string) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// Call callback with the path of each conflict until it returns false.
+func (idx *Index) forEachConflict(callback func(path string) bool) error {
+	var iter *C.git_index_conflict_iterator
+	ecode := C.git_index_conflict_iterator_new(&iter, idx.git_index)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	defer C.git_index_conflict_iterator_free(iter)
+	for {
+		var ancestor, our, their *C.git_index_entry
+		ecode = C.git_index_conflict_next(&ancestor, &our, &their, iter)
+		if ecode == git_ITEROVER {
+			return nil
+		} else if ecode != git_SUCCESS {
+			return gitError()
+		}
+		for _, entry := range []*C.git_index_entry{ancestor, our, their} {
+			if entry != nil {
+				if !callback(C.GoString(entry.path)) {
+					return nil
+				}
+				break
+			}
+		}
+	}
 }
 
+// The position of path at stage 0, or a negative number when it is not in
+// the index.
 func (idx *Index) Find(path string) int {
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
-	return int(C.git_index_find(idx.git_index, cpath))
+	var pos C.size_t
+	ecode := C.git_index_find(&pos, idx.git_index, cpath)
+	if ecode != git_SUCCESS {
+		return int(ecode)
+	}
+	return int(pos)
 }
 
 func (idx *Index) Free() {
@@ -82,16 +124,20 @@ func (idx *Index) Free() {
 
 func (idx *Index) Get(n uint) *IndexEntry {
 	entry := new(IndexEntry)
-	entry.git_index_entry = C.git_index_get(idx.git_index, C.uint(n))
+	entry.git_index_entry = C.git_index_get_byindex(idx.git_index, C.size_t(n))
 	return entry
 }
 
 func (idx *Index) GetUnmergedByIndex(n uint) *IndexEntryUnmerged {
-	entry := new(IndexEntryUnmerged)
-	entry.git_index_entry_unmerged = C.git_index_get_unmerged_byindex(idx.git_index, C.uint(n))
-	if entry.git_index_entry_unmerged == nil {
-		return nil
-	}
+	var entry *IndexEntryUnmerged
+	idx.forEachConflict(func(path string) bool {
+		if n > 0 {
+			n--
+			return true
+		}
+		entry = idx.GetUnmergedByPath(path)
+		return false
+	})
 	return entry
 }
 
@@ -99,15 +145,25 @@ func (idx *Index) GetUnmergedByPath(path string) *IndexEntryUnmerged {
 	entry := new(IndexEntryUnmerged)
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
-	entry.git_index_entry_unmerged = C.git_index_get_unmerged_bypath(idx.git_index, cpath)
-	if entry.git_index_entry_unmerged == nil {
+	var ancestor, our, their *C.git_index_entry
+	ecode := C.git_index_conflict_get(&ancestor, &our, &their, idx.git_index, cpath)
+	if ecode != git_SUCCESS {
 		return nil
 	}
+	entry.Path = path
+	for _, stage := range []struct {
+		out   **IndexEntry
+		entry *C.git_index_entry
+	}{{&entry.Ancestor, ancestor}, {&entry.Our, our}, {&entry.Their, their}} {
+		if stage.entry != nil {
+			*stage.out = &IndexEntry{stage.entry}
+		}
+	}
 	return entry
 }
 
 func (idx *Index) Read() error {
-	ecode := C.git_index_read(idx.git_index)
+	ecode := C.git_index_read(idx.git_index, C.int(c_TRUE))
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
@@ -122,16 +178,24 @@ func (idx *Index) ReadTree(tree *Tree) error {
 	return nil
 }
 
+// Remove the entry at position n.
 func (idx *Index) Remove(n int) error {
-	ecode := C.git_index_remove(idx.git_index, C.int(n))
+	centry := C.git_index_get_byindex(idx.git_index, C.size_t(n))
+	if centry == nil {
+		return errors.New("git2: no index entry at that position")
+	}
+	// The entry, path included, goes away with the removal.
+	cpath := C.CString(C.GoString(centry.path))
+	defer C.free(unsafe.Pointer(cpath))
+	ecode := C.git_index_remove(idx.git_index, cpath, C.git_index_entry_stage(centry))
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
 	return nil
 }
 
+// The index no longer holds duplicate entries, Unique does nothing.
 func (idx *Index) Unique() {
-	C.git_index_uniq(idx.git_index)
 }
 
 func (idx *Index) Write() error {
@@ -13,6 +13,18 @@ func (entry *IndexEntry) Stage() int {
 	return int(C.git_index_entry_stage(entry.git_index_entry))
 }
 
+// The entries of a conflicted path, those absent from a stage are nil.
 type IndexEntryUnmerged struct {
-	git_index_entry_unmerged *C.git_index_entry_unmerged
+	Path     string
+	Ancestor *IndexEntry
+	Our      *IndexEntry
+	Their    *IndexEntry
+}
+
+func (entry *IndexEntry) Oid() *Oid {
+	return newOidFromC(&entry.git_index_entry.id)
+}
+
+func (entry *IndexEntry) Path() string {
+	return C.GoString(entry.git_index_entry.path)
 }
@@ -0,0 +1,20 @@
+#include <git2.h>
+#include "_cgo_export.h"
+
+int go_transfer_progress_callback2(const git_indexer_progress *stats, void *payload) {
+	git_indexer_progress *vstats = (git_indexer_progress *)stats;
+	return go_transfer_progress_callback(vstats, (uintptr_t)payload);
+}
+
+int goIndexerNew(git_indexer **out, const char *path, git_odb *odb, uintptr_t payload) {
+	git_indexer_options opts;
+	int error = git_indexer_options_init(&opts, GIT_INDEXER_OPTIONS_VERSION);
+	if (error < 0) {
+		return error;
+	}
+	if (payload != 0) {
+		opts.progress_cb = go_transfer_progress_callback2;
+		opts.progress_cb_payload = (void *)payload;
+	}
+	return git_indexer_new(out, path, 0, odb, &opts);
+}
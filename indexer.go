@@ -2,102 +2,213 @@ package git2
 
 // #cgo pkg-config: libgit2
 // #include <git2.h>
+// extern int go_transfer_progress_callback(git_indexer_progress *stats, uintptr_t payload);
+// extern int goIndexerNew(git_indexer **out, const char *path, git_odb *odb, uintptr_t payload);
 import "C"
 import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"unsafe"
 )
 
+// Indexes the pack file packname in place, writing its index next to it as
+// pack-<hash>.idx.
 func NewIndexer(packname string) (*Indexer, error) {
-	idxr := new(Indexer)
-	cpackname := C.CString(packname)
-	defer C.free(unsafe.Pointer(cpackname))
-	ecode := C.git_indexer_new(&idxr.git_indexer, cpackname)
-	if ecode != git_SUCCESS {
-		return nil, gitError()
+	// libgit2 1.x only indexes streams, storing a copy of the pack along
+	// with the index. Let it do that in a scratch directory and keep only
+	// the index.
+	scratch, err := ioutil.TempDir("", "git2-indexer")
+	if err != nil {
+		return nil, err
 	}
-	return idxr, nil
+	stream, err := NewIndexerStream(scratch, nil, nil, nil)
+	if err != nil {
+		os.RemoveAll(scratch)
+		return nil, err
+	}
+	return &Indexer{packname, scratch, stream}, nil
 }
 
 type Indexer struct {
-	git_indexer *C.git_indexer
+	packname string
+	scratch  string
+	stream   *IndexerStream
 }
 
 func (idxr *Indexer) Free() {
-	C.git_indexer_free(idxr.git_indexer)
+	idxr.stream.Free()
+	os.RemoveAll(idxr.scratch)
 }
 
 func (idxr *Indexer) Hash() *Oid {
-	oid := new(Oid)
-	oid.git_oid = C.git_indexer_hash(idxr.git_indexer)
-	if oid.git_oid == nil {
-		return nil
-	}
-	return oid
+	return idxr.stream.Hash()
 }
 
 func (idxr *Indexer) Run(stats *IndexerStats) error {
-	ecode := C.git_indexer_run(idxr.git_indexer, stats.git_indexer_stats)
-	if ecode != git_SUCCESS {
-		return gitError()
+	f, err := os.Open(idxr.packname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = io.Copy(idxr.stream, f); err == nil {
+		err = idxr.stream.Close()
 	}
-	return nil
+	if stats != nil {
+		*stats = idxr.stream.Stats()
+	}
+	return err
 }
 
+// Write the index built by Run into the directory of the pack.
 func (idxr *Indexer) Write() error {
-	ecode := C.git_indexer_write(idxr.git_indexer)
-	if ecode != git_SUCCESS {
-		return gitError()
+	if !idxr.stream.committed {
+		return errors.New("git2: the pack has not been indexed")
 	}
-	return nil
+	name := "pack-" + idxr.stream.Hash().String() + ".idx"
+	data, err := ioutil.ReadFile(filepath.Join(idxr.scratch, name))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(filepath.Dir(idxr.packname), name), data, 0444)
 }
 
+// Progress of downloading and indexing a pack.
 type IndexerStats struct {
-	git_indexer_stats *C.git_indexer_stats
+	TotalObjects    uint
+	IndexedObjects  uint
+	ReceivedObjects uint
+	// Objects injected from the local object database to complete a thin
+	// pack.
+	LocalObjects  uint
+	TotalDeltas   uint
+	IndexedDeltas uint
+	ReceivedBytes uint64
+}
+
+func newIndexerStatsFromC(cstats *C.git_indexer_progress) IndexerStats {
+	return IndexerStats{
+		TotalObjects:    uint(cstats.total_objects),
+		IndexedObjects:  uint(cstats.indexed_objects),
+		ReceivedObjects: uint(cstats.received_objects),
+		LocalObjects:    uint(cstats.local_objects),
+		TotalDeltas:     uint(cstats.total_deltas),
+		IndexedDeltas:   uint(cstats.indexed_deltas),
+		ReceivedBytes:   uint64(cstats.received_bytes),
+	}
 }
 
+type TransferProgressCallback func(stats IndexerStats, payload interface{}) error
+
+type transferProgressCallbackWrapper struct {
+	f TransferProgressCallback
+	d interface{}
+}
+
+//export go_transfer_progress_callback
+func go_transfer_progress_callback(cstats *C.git_indexer_progress, payload C.uintptr_t) C.int {
+	wrap := lookupCallback(payload).(*transferProgressCallbackWrapper)
+	err := wrap.f(newIndexerStatsFromC(cstats), wrap.d)
+	if err != nil {
+		return C.int(git_SUCCESS - 1)
+	}
+	return C.int(git_SUCCESS)
+}
+
+// Indexes a pack as it is written to it, storing it along with its .idx in
+// a directory once closed. Thin packs are completed with the bases found in
+// the object database the stream was created with.
 type IndexerStream struct {
-	git_indexer_stream *C.git_indexer_stream
+	git_indexer *C.git_indexer
+	// libgit2 updates the counters incrementally across calls.
+	stats C.git_indexer_progress
+	// Handle of the progress callback libgit2 holds on to, 0 when unset.
+	progress  C.uintptr_t
+	dir       string
+	committed bool
 }
 
-func NewIndexerStream(dir string) (*IndexerStream, error) {
-	stream := new(IndexerStream)
+// Index a pack into dir, calling callback (if not nil) as the pack is
+// processed. odb, which may be nil, provides the bases missing from thin
+// packs.
+func NewIndexerStream(dir string, odb *Odb, callback TransferProgressCallback, payload interface{}) (*IndexerStream, error) {
+	stream := &IndexerStream{dir: dir}
 	cdir := C.CString(dir)
 	defer C.free(unsafe.Pointer(cdir))
-	ecode := C.git_indexer_stream_new(&stream.git_indexer_stream, cdir)
+	var codb *C.git_odb
+	if odb != nil {
+		codb = odb.git_odb
+	}
+	if callback != nil {
+		stream.progress = trackCallback(&transferProgressCallbackWrapper{callback, payload})
+	}
+	ecode := C.goIndexerNew(&stream.git_indexer, cdir, codb, stream.progress)
 	if ecode != git_SUCCESS {
+		if stream.progress != 0 {
+			untrackCallback(stream.progress)
+		}
 		return nil, gitError()
 	}
 	return stream, nil
 }
 
-func (stream *IndexerStream) Add(data []byte, stats *IndexerStats) error {
+// Feed the next part of the pack to the indexer.
+func (stream *IndexerStream) Write(data []byte) (int, error) {
+	if stream.committed {
+		return 0, errors.New("git2: write to a closed indexer stream")
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
 	cdata := unsafe.Pointer(&data[0])
-	defer C.free(cdata)
 	length := C.size_t(len(data))
-	ecode := C.git_indexer_stream_add(stream.git_indexer_stream, cdata, length, stats.git_indexer_stats)
+	ecode := C.git_indexer_append(stream.git_indexer, cdata, length, &stream.stats)
 	if ecode != git_SUCCESS {
-		return gitError()
+		return 0, gitError()
 	}
-	return nil
+	return len(data), nil
 }
 
-func (stream *IndexerStream) Finalize(stats IndexerStats) error {
-	ecode := C.git_indexer_stream_finalize(stream.git_indexer_stream, stats.git_indexer_stats)
-	if ecode != git_SUCCESS {
-		return gitError()
+// Finish indexing once the whole pack has been written, returning the path
+// of the stored pack and its checksum.
+func (stream *IndexerStream) Commit() (string, *Oid, error) {
+	if !stream.committed {
+		ecode := C.git_indexer_commit(stream.git_indexer, &stream.stats)
+		if ecode != git_SUCCESS {
+			return "", nil, gitError()
+		}
+		stream.committed = true
 	}
-	return nil
+	hash := stream.Hash()
+	name := filepath.Join(stream.dir, "pack-"+hash.String()+".pack")
+	return name, hash, nil
+}
+
+// Like Commit, for use as an io.WriteCloser. The stored pack's path and
+// checksum are still available afterwards from Commit, which does not
+// index the pack again, or from Hash. The stream must still be freed.
+func (stream *IndexerStream) Close() error {
+	_, _, err := stream.Commit()
+	return err
+}
+
+func (stream *IndexerStream) Stats() IndexerStats {
+	return newIndexerStatsFromC(&stream.stats)
 }
 
 func (stream *IndexerStream) Free() {
-	C.git_indexer_stream_free(stream.git_indexer_stream)
+	C.git_indexer_free(stream.git_indexer)
+	if stream.progress != 0 {
+		untrackCallback(stream.progress)
+	}
 }
 
 func (stream *IndexerStream) Hash() *Oid {
-	oid := new(Oid)
-	oid.git_oid = C.git_indexer_stream_hash(stream.git_indexer_stream)
-	if oid.git_oid == nil {
+	name := C.git_indexer_name(stream.git_indexer)
+	if name == nil {
 		return nil
 	}
-	return oid
+	return OidFromString(C.GoString(name))
 }
@@ -0,0 +1,247 @@
+package git2
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A pack holding everything reachable from HEAD, and the number of objects
+// in it.
+func createTestPack(t *testing.T, repo *Repository) ([]byte, uint) {
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer head.Free()
+	pb, err := repo.NewPackBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pb.Free()
+	if err = pb.InsertCommit(head.Oid()); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = pb.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), pb.ObjectCount()
+}
+
+func TestIndexerStream(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	commitTestFiles(t, repo, map[string]string{"a": "a", "dir/b": "b"}, "first")
+	pack, count := createTestPack(t, repo)
+
+	dir, err := ioutil.TempDir("", "git2-indexer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	calls := 0
+	stream, err := NewIndexerStream(dir, nil, func(stats IndexerStats, payload interface{}) error {
+		calls++
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Free()
+
+	// Feed the pack in small pieces, as a network transfer would.
+	for i := 0; i < len(pack); i += 7 {
+		end := i + 7
+		if end > len(pack) {
+			end = len(pack)
+		}
+		if _, err = stream.Write(pack[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	name, hash, err := stream.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls == 0 {
+		t.Error("the progress callback was never called")
+	}
+	stats := stream.Stats()
+	if stats.TotalObjects != count || stats.IndexedObjects != count {
+		t.Errorf("indexed %d of %d objects, want %d", stats.IndexedObjects, stats.TotalObjects, count)
+	}
+	if stats.ReceivedBytes != uint64(len(pack)) {
+		t.Errorf("received %d bytes, want %d", stats.ReceivedBytes, len(pack))
+	}
+	if want := filepath.Join(dir, "pack-"+hash.String()+".pack"); name != want {
+		t.Errorf("pack stored as %s, want %s", name, want)
+	}
+	for _, ext := range []string{".pack", ".idx"} {
+		if _, err = os.Stat(filepath.Join(dir, "pack-"+hash.String()+ext)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestIndexerInPlace(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	commitTestFiles(t, repo, map[string]string{"a": "a", "dir/b": "b"}, "first")
+	pack, count := createTestPack(t, repo)
+
+	dir, err := ioutil.TempDir("", "git2-indexer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	packname := filepath.Join(dir, "incoming.pack")
+	if err = ioutil.WriteFile(packname, pack, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idxr, err := NewIndexer(packname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idxr.Free()
+	var stats IndexerStats
+	if err = idxr.Run(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.IndexedObjects != count {
+		t.Errorf("indexed %d objects, want %d", stats.IndexedObjects, count)
+	}
+	if err = idxr.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pack stays where it is, with no copy beside it.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	want := []string{"incoming.pack", "pack-" + idxr.Hash().String() + ".idx"}
+	if len(names) != 2 || names[0] != want[0] || names[1] != want[1] {
+		t.Errorf("the pack directory holds %v, want %v", names, want)
+	}
+}
+
+// A thin pack holding a single blob stored as a delta against base, which
+// is left out of the pack. The blob is base followed by suffix.
+func createThinTestPack(t *testing.T, base *Oid, baseSize int, suffix string) []byte {
+	var delta bytes.Buffer
+	writeSize := func(size int) {
+		for ; size >= 0x80; size >>= 7 {
+			delta.WriteByte(byte(size) | 0x80)
+		}
+		delta.WriteByte(byte(size))
+	}
+	writeSize(baseSize)
+	writeSize(baseSize + len(suffix))
+	// Copy the whole base, which must be shorter than 256 bytes, then
+	// insert the suffix.
+	delta.Write([]byte{0x90, byte(baseSize)})
+	delta.WriteByte(byte(len(suffix)))
+	delta.WriteString(suffix)
+
+	var pack bytes.Buffer
+	pack.WriteString("PACK")
+	binary.Write(&pack, binary.BigEndian, uint32(2))
+	binary.Write(&pack, binary.BigEndian, uint32(1))
+	size := delta.Len()
+	header := byte(OBJ_REF_DELTA)<<4 | byte(size&0x0f)
+	for size >>= 4; size > 0; size >>= 7 {
+		pack.WriteByte(header | 0x80)
+		header = byte(size & 0x7f)
+	}
+	pack.WriteByte(header)
+	raw, err := hex.DecodeString(base.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack.Write(raw)
+	z := zlib.NewWriter(&pack)
+	z.Write(delta.Bytes())
+	z.Close()
+	sum := sha1.Sum(pack.Bytes())
+	pack.Write(sum[:])
+	return pack.Bytes()
+}
+
+func TestIndexerStreamThinPack(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	content := "the base of the delta\n"
+	base, err := repo.CreateBlob([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	odb, err := repo.Odb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer odb.Free()
+	target, err := odb.Hash([]byte(content+"and more\n"), OBJ_BLOB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack := createThinTestPack(t, base, len(content), "and more\n")
+
+	dir, err := ioutil.TempDir("", "git2-indexer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stream, err := NewIndexerStream(dir, odb, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Free()
+	if _, err = stream.Write(pack); err != nil {
+		t.Fatal(err)
+	}
+	// Commit after Close returns the stored pack without indexing again.
+	if err = stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name, hash, err := stream.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash.Compare(stream.Hash()) != 0 {
+		t.Errorf("Commit returned %s, Hash %s", hash, stream.Hash())
+	}
+	if stats := stream.Stats(); stats.LocalObjects != 1 {
+		t.Errorf("%d local objects, want 1", stats.LocalObjects)
+	}
+
+	// The stored pack was completed with the base.
+	packfile, err := OpenPackfile(strings.TrimSuffix(name, ".pack") + ".idx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = packfile.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]bool)
+	for _, entry := range packfile.Entries {
+		found[entry.Id.String()] = true
+	}
+	if len(found) != 2 || !found[base.String()] || !found[target.String()] {
+		t.Errorf("the pack holds %v, want %s and %s", found, base, target)
+	}
+}
@@ -6,6 +6,7 @@ import "C"
 
 func (repo *Repository) MergeBase(one, two Oid) (*Oid, error) {
 	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
 	ecode := C.git_merge_base(oid.git_oid, repo.git_repository, one.git_oid, two.git_oid)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
@@ -21,7 +21,7 @@ func (note *Note) Message() string {
 
 func (note *Note) Oid() *Oid {
 	oid := new(Oid)
-	oid.git_oid = C.git_note_oid(note.git_note)
+	oid.git_oid = C.git_note_id(note.git_note)
 	if oid.git_oid == nil {
 		return nil
 	}
@@ -30,6 +30,7 @@ func (note *Note) Oid() *Oid {
 
 func (repo *Repository) CreateNote(author, committer *Signature, ref string, oid *Oid, note string) (*Oid, error) {
 	out := new(Oid)
+	out.git_oid = new(C.git_oid)
 	var cref *C.char
 	if ref != "" {
 		cref = C.CString(ref)
@@ -40,7 +41,7 @@ func (repo *Repository) CreateNote(author, committer *Signature, ref string, oid
 		cnote = C.CString(note)
 		defer C.free(unsafe.Pointer(cnote))
 	}
-	ecode := C.git_note_create(out.git_oid, repo.git_repository, author.git_signature, committer.git_signature, cref, oid.git_oid, cnote)
+	ecode := C.git_note_create(out.git_oid, repo.git_repository, cref, author.git_signature, committer.git_signature, oid.git_oid, cnote, C.int(c_FALSE))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -48,13 +49,13 @@ func (repo *Repository) CreateNote(author, committer *Signature, ref string, oid
 }
 
 func (repo *Repository) DefaultNoteRef() (string, error) {
-	var ref [1]int8
-	cref := (*C.char)(&ref[0])
+	var cref C.git_buf
+	defer C.git_buf_dispose(&cref)
 	ecode := C.git_note_default_ref(&cref, repo.git_repository)
 	if ecode != git_SUCCESS {
 		return "", gitError()
 	}
-	return C.GoString(cref), nil
+	return C.GoString(cref.ptr), nil
 }
 
 func (repo *Repository) ReadNote(ref string, oid *Oid) (*Note, error) {
@@ -14,11 +14,11 @@ func ObjectString2Type(str string) ObjectType {
 }
 
 func ObjectType2String(form ObjectType) string {
-	return C.GoString(C.git_object_type2string(C.git_otype(form)))
+	return C.GoString(C.git_object_type2string(C.git_object_t(form)))
 }
 
 func ObjectTypeIsLoose(form ObjectType) bool {
-	return C.git_object_typeisloose(C.git_otype(form)) != c_FALSE
+	return C.git_object_typeisloose(C.git_object_t(form)) != c_FALSE
 }
 
 type ObjectType int
@@ -50,7 +50,6 @@ type Object struct {
 
 func (obj *Object) Free() {
 	C.git_object_free(obj.git_object)
-	C.free(unsafe.Pointer(obj.git_object))
 }
 
 func (obj *Object) Id() *Oid {
@@ -77,7 +76,7 @@ func (obj *Object) Type() ObjectType {
 
 func (repo *Repository) LookupObject(id *Oid, form ObjectType) (*Object, error) {
 	obj := new(Object)
-	ecode := C.git_object_lookup(&obj.git_object, repo.git_repository, id.git_oid, C.git_otype(form))
+	ecode := C.git_object_lookup(&obj.git_object, repo.git_repository, id.git_oid, C.git_object_t(form))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -86,7 +85,7 @@ func (repo *Repository) LookupObject(id *Oid, form ObjectType) (*Object, error)
 
 func (repo *Repository) LookupObjectPrefix(id *Oid, n uint, form ObjectType) (*Object, error) {
 	obj := new(Object)
-	ecode := C.git_object_lookup_prefix(&obj.git_object, repo.git_repository, id.git_oid, C.uint(n), C.git_otype(form))
+	ecode := C.git_object_lookup_prefix(&obj.git_object, repo.git_repository, id.git_oid, C.size_t(n), C.git_object_t(form))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
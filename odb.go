@@ -11,6 +11,48 @@ type OdbBackend struct {
 	git_odb_backend *C.git_odb_backend
 }
 
+// libgit2's store of loose objects in objectsDir, zlib compressing them at
+// compressionLevel, -1 meaning the default, and syncing every object to
+// disk when doFsync is set.
+func NewLooseBackend(objectsDir string, compressionLevel int, doFsync bool) (*OdbBackend, error) {
+	backend := new(OdbBackend)
+	cdir := C.CString(objectsDir)
+	defer C.free(unsafe.Pointer(cdir))
+	cfsync := C.int(c_FALSE)
+	if doFsync {
+		cfsync = C.int(c_TRUE)
+	}
+	ecode := C.git_odb_backend_loose(&backend.git_odb_backend, cdir, C.int(compressionLevel), cfsync, 0, 0)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return backend, nil
+}
+
+// libgit2's read-only store of the packs in objectsDir/pack.
+func NewPackBackend(objectsDir string) (*OdbBackend, error) {
+	backend := new(OdbBackend)
+	cdir := C.CString(objectsDir)
+	defer C.free(unsafe.Pointer(cdir))
+	ecode := C.git_odb_backend_pack(&backend.git_odb_backend, cdir)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return backend, nil
+}
+
+// A read-only store of the single pack indexed by idxPath.
+func NewOnePackBackend(idxPath string) (*OdbBackend, error) {
+	backend := new(OdbBackend)
+	cpath := C.CString(idxPath)
+	defer C.free(unsafe.Pointer(cpath))
+	ecode := C.git_odb_backend_one_pack(&backend.git_odb_backend, cpath)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return backend, nil
+}
+
 type OdbStream struct {
 	git_odb_stream *C.git_odb_stream
 }
@@ -59,16 +101,29 @@ func (odb *Odb) Exists(oid *Oid) bool {
 	return C.git_odb_exists(odb.git_odb, oid.git_oid) != c_FALSE
 }
 
+// Look for objects added to the backends since they were opened, such as
+// newly indexed packs.
+func (odb *Odb) Refresh() error {
+	ecode := C.git_odb_refresh(odb.git_odb)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
 func (odb *Odb) Free() {
 	C.git_odb_free(odb.git_odb)
 }
 
 func (odb *Odb) Hash(data []byte, form ObjectType) (*Oid, error) {
 	oid := new(Oid)
-	cdata := unsafe.Pointer(&data[0])
-	defer C.free(cdata)
+	oid.git_oid = new(C.git_oid)
+	var cdata unsafe.Pointer
+	if len(data) > 0 {
+		cdata = unsafe.Pointer(&data[0])
+	}
 	length := C.size_t(len(data))
-	ecode := C.git_odb_hash(oid.git_oid, cdata, length, C.git_otype(form))
+	ecode := C.git_odb_hash(oid.git_oid, cdata, length, C.git_object_t(form))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -77,9 +132,10 @@ func (odb *Odb) Hash(data []byte, form ObjectType) (*Oid, error) {
 
 func (odb *Odb) HashFile(path string, form ObjectType) (*Oid, error) {
 	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
-	ecode := C.git_odb_hashfile(oid.git_oid, cpath, C.git_otype(form))
+	ecode := C.git_odb_hashfile(oid.git_oid, cpath, C.git_object_t(form))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -88,7 +144,9 @@ func (odb *Odb) HashFile(path string, form ObjectType) (*Oid, error) {
 
 func (odb *Odb) OpenRStream(oid *Oid) (*OdbStream, error) {
 	stream := new(OdbStream)
-	ecode := C.git_odb_open_rstream(&stream.git_odb_stream, odb.git_odb, oid.git_oid)
+	var clen C.size_t
+	var ctype C.git_object_t
+	ecode := C.git_odb_open_rstream(&stream.git_odb_stream, &clen, &ctype, odb.git_odb, oid.git_oid)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -97,7 +155,7 @@ func (odb *Odb) OpenRStream(oid *Oid) (*OdbStream, error) {
 
 func (odb *Odb) OpenWStream(size int, form ObjectType) (*OdbStream, error) {
 	stream := new(OdbStream)
-	ecode := C.git_odb_open_wstream(&stream.git_odb_stream, odb.git_odb, C.size_t(size), C.git_otype(form))
+	ecode := C.git_odb_open_wstream(&stream.git_odb_stream, odb.git_odb, C.git_object_size_t(size), C.git_object_t(form))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -146,7 +204,7 @@ func (odb *Odb) Read(oid *Oid) (*OdbObject, error) {
 
 func (odb *Odb) ReadHeader(oid *Oid) (int, ObjectType, error) {
 	var clen C.size_t
-	var ctype C.git_otype
+	var ctype C.git_object_t
 	ecode := C.git_odb_read_header(&clen, &ctype, odb.git_odb, oid.git_oid)
 	if ecode != git_SUCCESS {
 		return int(clen), ObjectType(ctype), gitError()
@@ -156,7 +214,7 @@ func (odb *Odb) ReadHeader(oid *Oid) (int, ObjectType, error) {
 
 func (odb *Odb) ReadPrefix(oid *Oid, n uint) (*OdbObject, error) {
 	obj := new(OdbObject)
-	ecode := C.git_odb_read_prefix(&obj.git_odb_object, odb.git_odb, oid.git_oid, C.uint(n))
+	ecode := C.git_odb_read_prefix(&obj.git_odb_object, odb.git_odb, oid.git_oid, C.size_t(n))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -165,10 +223,13 @@ func (odb *Odb) ReadPrefix(oid *Oid, n uint) (*OdbObject, error) {
 
 func (odb *Odb) Write(data []byte, form ObjectType) (*Oid, error) {
 	oid := new(Oid)
-	cdata := unsafe.Pointer(&data[0])
-	defer C.free(cdata)
+	oid.git_oid = new(C.git_oid)
+	var cdata unsafe.Pointer
+	if len(data) > 0 {
+		cdata = unsafe.Pointer(&data[0])
+	}
 	length := C.size_t(len(data))
-	ecode := C.git_odb_write(oid.git_oid, odb.git_odb, cdata, length, C.git_otype(form))
+	ecode := C.git_odb_write(oid.git_oid, odb.git_odb, cdata, length, C.git_object_t(form))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
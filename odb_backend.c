@@ -0,0 +1,74 @@
+#include <stdlib.h>
+#include <git2.h>
+#include <git2/sys/odb_backend.h>
+#include "_cgo_export.h"
+
+typedef struct {
+	git_odb_backend parent;
+	uintptr_t handle;
+} go_odb_backend;
+
+static int go_odb_backend_read2(void **data, size_t *len, git_object_t *type, git_odb_backend *backend, const git_oid *oid) {
+	go_odb_backend *b = (go_odb_backend *)backend;
+	return go_odb_backend_read(b->handle, backend, data, len, type, (git_oid *)oid);
+}
+
+static int go_odb_backend_read_prefix2(git_oid *out, void **data, size_t *len, git_object_t *type, git_odb_backend *backend, const git_oid *prefix, size_t prefix_len) {
+	go_odb_backend *b = (go_odb_backend *)backend;
+	return go_odb_backend_read_prefix(b->handle, backend, out, data, len, type, (git_oid *)prefix, prefix_len);
+}
+
+static int go_odb_backend_read_header2(size_t *len, git_object_t *type, git_odb_backend *backend, const git_oid *oid) {
+	go_odb_backend *b = (go_odb_backend *)backend;
+	return go_odb_backend_read_header(b->handle, len, type, (git_oid *)oid);
+}
+
+static int go_odb_backend_write2(git_odb_backend *backend, const git_oid *oid, const void *data, size_t len, git_object_t type) {
+	go_odb_backend *b = (go_odb_backend *)backend;
+	return go_odb_backend_write(b->handle, (git_oid *)oid, (void *)data, len, type);
+}
+
+static int go_odb_backend_exists2(git_odb_backend *backend, const git_oid *oid) {
+	go_odb_backend *b = (go_odb_backend *)backend;
+	return go_odb_backend_exists(b->handle, (git_oid *)oid);
+}
+
+static int go_odb_backend_refresh2(git_odb_backend *backend) {
+	go_odb_backend *b = (go_odb_backend *)backend;
+	return go_odb_backend_refresh(b->handle);
+}
+
+static int go_odb_backend_foreach2(git_odb_backend *backend, git_odb_foreach_cb cb, void *payload) {
+	go_odb_backend *b = (go_odb_backend *)backend;
+	return go_odb_backend_foreach(b->handle, cb, payload);
+}
+
+static void go_odb_backend_free2(git_odb_backend *backend) {
+	go_odb_backend *b = (go_odb_backend *)backend;
+	go_odb_backend_free(b->handle);
+	free(b);
+}
+
+int goOdbForEachCall(git_odb_foreach_cb cb, git_oid *oid, void *payload) {
+	return cb(oid, payload);
+}
+
+int goOdbBackendNew(git_odb_backend **out, uintptr_t handle) {
+	go_odb_backend *b = calloc(1, sizeof(go_odb_backend));
+	if (b == NULL) {
+		git_error_set_oom();
+		return -1;
+	}
+	git_odb_init_backend(&b->parent, GIT_ODB_BACKEND_VERSION);
+	b->parent.read = go_odb_backend_read2;
+	b->parent.read_prefix = go_odb_backend_read_prefix2;
+	b->parent.read_header = go_odb_backend_read_header2;
+	b->parent.write = go_odb_backend_write2;
+	b->parent.exists = go_odb_backend_exists2;
+	b->parent.refresh = go_odb_backend_refresh2;
+	b->parent.foreach = go_odb_backend_foreach2;
+	b->parent.free = go_odb_backend_free2;
+	b->handle = handle;
+	*out = &b->parent;
+	return 0;
+}
@@ -0,0 +1,221 @@
+package git2
+
+// #cgo pkg-config: libgit2
+// #include <string.h>
+// #include <git2.h>
+// #include <git2/sys/odb_backend.h>
+// extern int goOdbBackendNew(git_odb_backend **out, uintptr_t handle);
+// extern int goOdbForEachCall(git_odb_foreach_cb cb, git_oid *oid, void *payload);
+import "C"
+import (
+	"errors"
+	"sync"
+	"unsafe"
+)
+
+const git_EAMBIGUOUS = -5
+
+// Returned by backends for objects they do not have, and for prefixes
+// that match more than one object.
+var (
+	ErrOdbNotFound  = errors.New("git2: object not found")
+	ErrOdbAmbiguous = errors.New("git2: ambiguous object prefix")
+)
+
+var errOdbBackendFreed = errors.New("git2: the odb backend has been freed")
+
+// An object store implemented in Go, made into an OdbBackend with
+// NewOdbBackend. The methods may be called from several threads at once.
+type OdbBackendInterface interface {
+	Read(oid *Oid) ([]byte, ObjectType, error)
+	// Find the only object whose id starts with the first length hex
+	// digits of prefix.
+	ReadPrefix(prefix *Oid, length uint) (*Oid, []byte, ObjectType, error)
+	ReadHeader(oid *Oid) (int, ObjectType, error)
+	Write(oid *Oid, data []byte, objType ObjectType) error
+	Exists(oid *Oid) bool
+	// Call callback with the id of every object, stopping at the first
+	// error, which is returned.
+	ForEach(callback func(oid *Oid) error) error
+	// Pick up objects added to the store by others.
+	Refresh() error
+}
+
+// The implementations libgit2 holds on to, Go pointers cannot be kept in C
+// memory.
+var odbBackends = struct {
+	sync.Mutex
+	next  uintptr
+	impls map[uintptr]OdbBackendInterface
+}{
+	impls: make(map[uintptr]OdbBackendInterface),
+}
+
+// Wrap impl for use with Odb.AddBackend and Odb.AddAlternate. Once added,
+// the backend belongs to the Odb and is freed along with it.
+func NewOdbBackend(impl OdbBackendInterface) (*OdbBackend, error) {
+	odbBackends.Lock()
+	odbBackends.next++
+	handle := odbBackends.next
+	odbBackends.impls[handle] = impl
+	odbBackends.Unlock()
+
+	backend := new(OdbBackend)
+	ecode := C.goOdbBackendNew(&backend.git_odb_backend, C.uintptr_t(handle))
+	if ecode != git_SUCCESS {
+		go_odb_backend_free(C.uintptr_t(handle))
+		return nil, gitError()
+	}
+	return backend, nil
+}
+
+// The implementation behind handle, or errOdbBackendFreed once libgit2 has
+// freed the backend.
+func lookupOdbBackend(handle C.uintptr_t) (OdbBackendInterface, error) {
+	odbBackends.Lock()
+	defer odbBackends.Unlock()
+	impl, ok := odbBackends.impls[uintptr(handle)]
+	if !ok {
+		return nil, errOdbBackendFreed
+	}
+	return impl, nil
+}
+
+func odbBackendError(err error) C.int {
+	switch err {
+	case ErrOdbNotFound:
+		return C.int(git_ENOTFOUND)
+	case ErrOdbAmbiguous:
+		return C.int(git_EAMBIGUOUS)
+	}
+	setGitError(C.GIT_ERROR_ODB, err)
+	return C.int(git_SUCCESS - 1)
+}
+
+// Hand data to libgit2 in a buffer it can free.
+func odbBackendData(backend *C.git_odb_backend, data []byte) unsafe.Pointer {
+	buf := C.git_odb_backend_data_alloc(backend, C.size_t(len(data)))
+	if len(data) > 0 {
+		C.memcpy(buf, unsafe.Pointer(&data[0]), C.size_t(len(data)))
+	}
+	return buf
+}
+
+//export go_odb_backend_read
+func go_odb_backend_read(handle C.uintptr_t, backend *C.git_odb_backend, out *unsafe.Pointer, outLen *C.size_t, outType *C.git_object_t, coid *C.git_oid) C.int {
+	impl, err := lookupOdbBackend(handle)
+	if err != nil {
+		return odbBackendError(err)
+	}
+	data, objType, err := impl.Read(newOidFromC(coid))
+	if err != nil {
+		return odbBackendError(err)
+	}
+	*out = odbBackendData(backend, data)
+	*outLen = C.size_t(len(data))
+	*outType = C.git_object_t(objType)
+	return C.int(git_SUCCESS)
+}
+
+//export go_odb_backend_read_prefix
+func go_odb_backend_read_prefix(handle C.uintptr_t, backend *C.git_odb_backend, outId *C.git_oid, out *unsafe.Pointer, outLen *C.size_t, outType *C.git_object_t, cprefix *C.git_oid, length C.size_t) C.int {
+	impl, err := lookupOdbBackend(handle)
+	if err != nil {
+		return odbBackendError(err)
+	}
+	oid, data, objType, err := impl.ReadPrefix(newOidFromC(cprefix), uint(length))
+	if err != nil {
+		return odbBackendError(err)
+	}
+	C.git_oid_cpy(outId, oid.git_oid)
+	*out = odbBackendData(backend, data)
+	*outLen = C.size_t(len(data))
+	*outType = C.git_object_t(objType)
+	return C.int(git_SUCCESS)
+}
+
+//export go_odb_backend_read_header
+func go_odb_backend_read_header(handle C.uintptr_t, outLen *C.size_t, outType *C.git_object_t, coid *C.git_oid) C.int {
+	impl, err := lookupOdbBackend(handle)
+	if err != nil {
+		return odbBackendError(err)
+	}
+	size, objType, err := impl.ReadHeader(newOidFromC(coid))
+	if err != nil {
+		return odbBackendError(err)
+	}
+	*outLen = C.size_t(size)
+	*outType = C.git_object_t(objType)
+	return C.int(git_SUCCESS)
+}
+
+//export go_odb_backend_write
+func go_odb_backend_write(handle C.uintptr_t, coid *C.git_oid, data unsafe.Pointer, length C.size_t, objType C.git_object_t) C.int {
+	impl, err := lookupOdbBackend(handle)
+	if err != nil {
+		return odbBackendError(err)
+	}
+	err = impl.Write(newOidFromC(coid), C.GoBytes(data, C.int(length)), ObjectType(objType))
+	if err != nil {
+		return odbBackendError(err)
+	}
+	return C.int(git_SUCCESS)
+}
+
+//export go_odb_backend_exists
+func go_odb_backend_exists(handle C.uintptr_t, coid *C.git_oid) C.int {
+	// libgit2 takes any non-zero result for found, so a freed backend has
+	// nothing.
+	impl, err := lookupOdbBackend(handle)
+	if err == nil && impl.Exists(newOidFromC(coid)) {
+		return C.int(c_TRUE)
+	}
+	return C.int(c_FALSE)
+}
+
+//export go_odb_backend_refresh
+func go_odb_backend_refresh(handle C.uintptr_t) C.int {
+	impl, err := lookupOdbBackend(handle)
+	if err != nil {
+		return odbBackendError(err)
+	}
+	if err = impl.Refresh(); err != nil {
+		return odbBackendError(err)
+	}
+	return C.int(git_SUCCESS)
+}
+
+// Carries the code a libgit2 foreach callback stopped with through the
+// Go implementation.
+type odbForEachStop C.int
+
+func (stop odbForEachStop) Error() string {
+	return "git2: foreach callback stopped the iteration"
+}
+
+//export go_odb_backend_foreach
+func go_odb_backend_foreach(handle C.uintptr_t, cb C.git_odb_foreach_cb, payload unsafe.Pointer) C.int {
+	impl, err := lookupOdbBackend(handle)
+	if err != nil {
+		return odbBackendError(err)
+	}
+	err = impl.ForEach(func(oid *Oid) error {
+		if ret := C.goOdbForEachCall(cb, oid.git_oid, payload); ret != 0 {
+			return odbForEachStop(ret)
+		}
+		return nil
+	})
+	if stop, ok := err.(odbForEachStop); ok {
+		return C.int(stop)
+	} else if err != nil {
+		return odbBackendError(err)
+	}
+	return C.int(git_SUCCESS)
+}
+
+//export go_odb_backend_free
+func go_odb_backend_free(handle C.uintptr_t) {
+	odbBackends.Lock()
+	delete(odbBackends.impls, uintptr(handle))
+	odbBackends.Unlock()
+}
@@ -0,0 +1,88 @@
+package git2
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestMemoryOdbBackendRepository(t *testing.T) {
+	repo, cleanup := createTestRepo(t, true)
+	defer cleanup()
+
+	memory := NewMemoryOdbBackend()
+	backend, err := NewOdbBackend(memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	odb, err := NewOdb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer odb.Free()
+	if err = odb.AddBackend(backend, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.SetOdb(odb); err != nil {
+		t.Fatal(err)
+	}
+
+	blobId, err := repo.CreateBlob([]byte("hello\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A tree holding the blob as "hello": mode, name, NUL and raw id.
+	raw, err := hex.DecodeString(blobId.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	treeId, err := odb.Write(append([]byte("100644 hello\x00"), raw...), OBJ_TREE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := repo.LookupTree(treeId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Free()
+	sig := testSignature(t)
+	defer sig.Free()
+	commitId, err := repo.CreateCommit("HEAD", sig, sig, "UTF-8", "in memory\n", tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []*Oid{blobId, treeId, commitId} {
+		if !memory.Exists(id) {
+			t.Errorf("%v is not in the memory backend", id)
+		}
+	}
+
+	commit, err := repo.LookupCommit(commitId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer commit.Free()
+	if commit.Message() != "in memory\n" {
+		t.Errorf("commit message %q", commit.Message())
+	}
+	readTree, err := commit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readTree.Free()
+	if readTree.Id().Compare(treeId) != 0 {
+		t.Fatalf("commit tree %v, want %v", readTree.Id(), treeId)
+	}
+	entry := readTree.EntryByName("hello")
+	if entry == nil || entry.Id().Compare(blobId) != 0 {
+		t.Fatalf("tree entry %v, want hello at %v", entry, blobId)
+	}
+	blob, err := repo.LookupBlob(blobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Free()
+	if string(blob.Content()) != "hello\n" {
+		t.Errorf("blob content %q", blob.Content())
+	}
+}
@@ -0,0 +1,100 @@
+package git2
+
+import (
+	"strings"
+	"sync"
+)
+
+type memoryObject struct {
+	data    []byte
+	objType ObjectType
+}
+
+// An OdbBackendInterface keeping the objects in memory, useful for tests
+// and as a starting point for backends built on other stores.
+type MemoryOdbBackend struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+func NewMemoryOdbBackend() *MemoryOdbBackend {
+	return &MemoryOdbBackend{objects: make(map[string]memoryObject)}
+}
+
+func (backend *MemoryOdbBackend) Read(oid *Oid) ([]byte, ObjectType, error) {
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+	obj, ok := backend.objects[oid.String()]
+	if !ok {
+		return nil, OBJ_BAD, ErrOdbNotFound
+	}
+	return obj.data, obj.objType, nil
+}
+
+func (backend *MemoryOdbBackend) ReadPrefix(prefix *Oid, length uint) (*Oid, []byte, ObjectType, error) {
+	hex := prefix.String()
+	if length < uint(len(hex)) {
+		hex = hex[:length]
+	}
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+	var found string
+	for id := range backend.objects {
+		if !strings.HasPrefix(id, hex) {
+			continue
+		}
+		if found != "" {
+			return nil, nil, OBJ_BAD, ErrOdbAmbiguous
+		}
+		found = id
+	}
+	if found == "" {
+		return nil, nil, OBJ_BAD, ErrOdbNotFound
+	}
+	obj := backend.objects[found]
+	return OidFromString(found), obj.data, obj.objType, nil
+}
+
+func (backend *MemoryOdbBackend) ReadHeader(oid *Oid) (int, ObjectType, error) {
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+	obj, ok := backend.objects[oid.String()]
+	if !ok {
+		return 0, OBJ_BAD, ErrOdbNotFound
+	}
+	return len(obj.data), obj.objType, nil
+}
+
+func (backend *MemoryOdbBackend) Write(oid *Oid, data []byte, objType ObjectType) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	backend.objects[oid.String()] = memoryObject{append([]byte(nil), data...), objType}
+	return nil
+}
+
+func (backend *MemoryOdbBackend) Exists(oid *Oid) bool {
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+	_, ok := backend.objects[oid.String()]
+	return ok
+}
+
+func (backend *MemoryOdbBackend) ForEach(callback func(oid *Oid) error) error {
+	// The callback may well use the backend itself.
+	backend.mu.RLock()
+	ids := make([]string, 0, len(backend.objects))
+	for id := range backend.objects {
+		ids = append(ids, id)
+	}
+	backend.mu.RUnlock()
+	for _, id := range ids {
+		if err := callback(OidFromString(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (backend *MemoryOdbBackend) Refresh() error {
+	return nil
+}
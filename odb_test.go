@@ -0,0 +1,75 @@
+package git2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinOdbBackends(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	head := commitTestFiles(t, repo, map[string]string{"a": "a\n"}, "first")
+	packPath, err := repo.Repack(&RepackOptions{DeleteRedundant: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "git2-odb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Packed history in front of a loose object directory taking the
+	// writes.
+	odb, err := NewOdb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer odb.Free()
+	packed, err := NewPackBackend(filepath.Join(repo.Path(), "objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = odb.AddBackend(packed, 2); err != nil {
+		t.Fatal(err)
+	}
+	loose, err := NewLooseBackend(dir, -1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = odb.AddBackend(loose, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, objType, err := odb.ReadHeader(head); err != nil || objType != OBJ_COMMIT {
+		t.Fatalf("read the head commit as %v: %v", objType, err)
+	}
+	id, err := odb.Write([]byte("new\n"), OBJ_BLOB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, id.String()[:2], id.String()[2:])); err != nil {
+		t.Errorf("the blob was not written loose: %v", err)
+	}
+
+	single, err := NewOdb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer single.Free()
+	onePack, err := NewOnePackBackend(strings.TrimSuffix(packPath, ".pack") + ".idx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = single.AddBackend(onePack, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !single.Exists(head) {
+		t.Error("the head commit is not in the pack")
+	}
+	if single.Exists(id) {
+		t.Error("the loose blob is in the pack")
+	}
+}
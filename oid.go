@@ -9,6 +9,7 @@ import (
 
 func OidFromRaw(raw string) *Oid {
 	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
 	craw := C.CString(raw)
 	// Ugly hack to get around git_oid_fromraw using unsigned char*
 	crawp := unsafe.Pointer(craw)
@@ -19,6 +20,7 @@ func OidFromRaw(raw string) *Oid {
 
 func OidFromString(str string) *Oid {
 	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
 	cstr := C.CString(str)
 	defer C.free(unsafe.Pointer(cstr))
 	length := C.size_t(len(str))
@@ -30,6 +32,17 @@ type Oid struct {
 	git_oid *C.git_oid
 }
 
+// Copy a git_oid owned by libgit2 into a new Oid.
+func newOidFromC(coid *C.git_oid) *Oid {
+	if coid == nil {
+		return nil
+	}
+	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
+	C.git_oid_cpy(oid.git_oid, coid)
+	return oid
+}
+
 func (oid *Oid) String() string {
 	buffer := make([]C.char, git_OID_HEXSZ+1)
 	length := C.size_t(cap(buffer))
@@ -41,25 +54,25 @@ func (oid *Oid) Compare(other *Oid) int {
 }
 
 func (oid *Oid) CompareN(other *Oid, n uint) int {
-	return int(C.git_oid_ncmp(oid.git_oid, other.git_oid, C.uint(n)))
+	return int(C.git_oid_ncmp(oid.git_oid, other.git_oid, C.size_t(n)))
 }
 
 func (oid *Oid) Copy() *Oid {
 	newOid := new(Oid)
+	newOid.git_oid = new(C.git_oid)
 	C.git_oid_cpy(newOid.git_oid, oid.git_oid)
 	return newOid
 }
 
 func (oid *Oid) IsZero() bool {
-	return C.git_oid_iszero(oid.git_oid) != c_FALSE
+	return C.git_oid_is_zero(oid.git_oid) != c_FALSE
 }
 
 func (oid *Oid) Path() string {
-	var path [git_OID_HEXSZ + 1]int8
-	cpath := (*C.char)(&path[0])
-	defer C.free(unsafe.Pointer(cpath))
-	C.git_oid_pathfmt(cpath, oid.git_oid)
-	return C.GoString(cpath)
+	// The hex digits with a slash after the first two, not terminated.
+	var path [git_OID_HEXSZ + 1]C.char
+	C.git_oid_pathfmt(&path[0], oid.git_oid)
+	return C.GoStringN(&path[0], C.int(len(path)))
 }
 
 func (oid *Oid) Equal(str string) (bool, error) {
@@ -0,0 +1,30 @@
+#include <git2.h>
+#include "_cgo_export.h"
+
+int go_packbuilder_foreach_callback2(void *buf, size_t size, void *payload) {
+	return go_packbuilder_foreach_callback(buf, size, (uintptr_t)payload);
+}
+
+int goPackbuilderForEach(git_packbuilder *pb, uintptr_t payload) {
+	return git_packbuilder_foreach(pb, go_packbuilder_foreach_callback2, (void *)payload);
+}
+
+int go_packbuilder_progress_callback2(int stage, unsigned int current, unsigned int total, void *payload) {
+	return go_packbuilder_progress_callback(stage, current, total, (uintptr_t)payload);
+}
+
+int goPackbuilderSetCallbacks(git_packbuilder *pb, uintptr_t payload) {
+	if (payload == 0) {
+		return git_packbuilder_set_callbacks(pb, NULL, NULL);
+	}
+	return git_packbuilder_set_callbacks(pb, go_packbuilder_progress_callback2, (void *)payload);
+}
+
+extern int go_transfer_progress_callback2(const git_indexer_progress *stats, void *payload);
+
+int goPackbuilderWrite(git_packbuilder *pb, const char *path, unsigned int mode, uintptr_t payload) {
+	if (payload == 0) {
+		return git_packbuilder_write(pb, path, mode, NULL, NULL);
+	}
+	return git_packbuilder_write(pb, path, mode, go_transfer_progress_callback2, (void *)payload);
+}
@@ -0,0 +1,253 @@
+package git2
+
+// #cgo pkg-config: libgit2
+// #include <git2.h>
+// extern int go_packbuilder_foreach_callback(void *buf, size_t size, uintptr_t payload);
+// extern int goPackbuilderForEach(git_packbuilder *pb, uintptr_t payload);
+// extern int goPackbuilderSetCallbacks(git_packbuilder *pb, uintptr_t payload);
+// extern int goPackbuilderWrite(git_packbuilder *pb, const char *path, unsigned int mode, uintptr_t payload);
+import "C"
+import (
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+)
+
+// The delta window and depth the pack builder searches deltas with, git's
+// defaults. libgit2 1.7 has no option to change them and does not read
+// pack.window or pack.depth, so SetDeltaWindow and SetDeltaDepth only
+// accept these values.
+const (
+	PACKBUILDER_DELTA_WINDOW = 10
+	PACKBUILDER_DELTA_DEPTH  = 50
+)
+
+// Generates packs from the objects inserted into it.
+type PackBuilder struct {
+	git_packbuilder *C.git_packbuilder
+	// Handle of the progress callback libgit2 holds on to, 0 when unset.
+	progress C.uintptr_t
+}
+
+func (repo *Repository) NewPackBuilder() (*PackBuilder, error) {
+	pb := new(PackBuilder)
+	ecode := C.git_packbuilder_new(&pb.git_packbuilder, repo.git_repository)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return pb, nil
+}
+
+func (pb *PackBuilder) Free() {
+	C.git_packbuilder_free(pb.git_packbuilder)
+	if pb.progress != 0 {
+		untrackCallback(pb.progress)
+	}
+}
+
+// Add a single object, name is the path it was found at (if any) and is
+// used to find good delta bases.
+func (pb *PackBuilder) Insert(oid *Oid, name string) error {
+	var cname *C.char
+	if name != "" {
+		cname = C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+	}
+	ecode := C.git_packbuilder_insert(pb.git_packbuilder, oid.git_oid, cname)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+// Add a tree along with everything it contains.
+func (pb *PackBuilder) InsertTree(oid *Oid) error {
+	ecode := C.git_packbuilder_insert_tree(pb.git_packbuilder, oid.git_oid)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+// Add an object along with everything it points at: the target of a tag,
+// the tree of a commit but not its parents, the contents of a tree.
+func (pb *PackBuilder) InsertRecursive(oid *Oid, name string) error {
+	var cname *C.char
+	if name != "" {
+		cname = C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+	}
+	ecode := C.git_packbuilder_insert_recur(pb.git_packbuilder, oid.git_oid, cname)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+// Add a commit along with its tree and everything the tree contains.
+func (pb *PackBuilder) InsertCommit(oid *Oid) error {
+	ecode := C.git_packbuilder_insert_commit(pb.git_packbuilder, oid.git_oid)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+// Add every commit the walk produces along with their trees, the walk is
+// run to completion.
+func (pb *PackBuilder) InsertWalk(walk *Revwalk) error {
+	ecode := C.git_packbuilder_insert_walk(pb.git_packbuilder, walk.git_revwalk)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+// Use up to n threads to search for deltas, 0 meaning one per CPU. Returns
+// the number that will actually be used, which is 1 when libgit2 was built
+// without thread support.
+func (pb *PackBuilder) SetThreads(n uint) uint {
+	return uint(C.git_packbuilder_set_threads(pb.git_packbuilder, C.uint(n)))
+}
+
+// Set how many objects are compared when searching for a delta. Fails
+// rather than building a different pack than asked for when window is not
+// PACKBUILDER_DELTA_WINDOW.
+func (pb *PackBuilder) SetDeltaWindow(window uint) error {
+	if window != PACKBUILDER_DELTA_WINDOW {
+		return fmt.Errorf("git2: libgit2 only supports a delta window of %d, not %d", PACKBUILDER_DELTA_WINDOW, window)
+	}
+	return nil
+}
+
+// Set the maximum length of a delta chain. Fails when depth is not
+// PACKBUILDER_DELTA_DEPTH, like SetDeltaWindow.
+func (pb *PackBuilder) SetDeltaDepth(depth uint) error {
+	if depth != PACKBUILDER_DELTA_DEPTH {
+		return fmt.Errorf("git2: libgit2 only supports a delta depth of %d, not %d", PACKBUILDER_DELTA_DEPTH, depth)
+	}
+	return nil
+}
+
+type PackBuilderStage int
+
+const (
+	PACKBUILDER_ADDING_OBJECTS PackBuilderStage = iota
+	PACKBUILDER_DELTAFICATION
+)
+
+func (stage PackBuilderStage) String() string {
+	switch stage {
+	case PACKBUILDER_ADDING_OBJECTS:
+		return "adding objects"
+	case PACKBUILDER_DELTAFICATION:
+		return "deltafication"
+	}
+	return "unknown"
+}
+
+// Reports progress while objects are inserted and deltas searched for, an
+// error aborts the operation.
+type PackBuilderProgressCallback func(stage PackBuilderStage, current, total uint, payload interface{}) error
+
+type packBuilderProgressCallbackWrapper struct {
+	f PackBuilderProgressCallback
+	d interface{}
+}
+
+// Set the callback reporting progress, a nil callback removes it.
+func (pb *PackBuilder) SetProgressCallback(callback PackBuilderProgressCallback, payload interface{}) error {
+	var data C.uintptr_t
+	if callback != nil {
+		data = trackCallback(&packBuilderProgressCallbackWrapper{callback, payload})
+	}
+	ecode := C.goPackbuilderSetCallbacks(pb.git_packbuilder, data)
+	if ecode != git_SUCCESS {
+		if data != 0 {
+			untrackCallback(data)
+		}
+		return gitError()
+	}
+	if pb.progress != 0 {
+		untrackCallback(pb.progress)
+	}
+	pb.progress = data
+	return nil
+}
+
+//export go_packbuilder_progress_callback
+func go_packbuilder_progress_callback(stage C.int, current, total C.uint, payload C.uintptr_t) C.int {
+	wrap := lookupCallback(payload).(*packBuilderProgressCallbackWrapper)
+	err := wrap.f(PackBuilderStage(stage), uint(current), uint(total), wrap.d)
+	if err != nil {
+		return C.int(git_SUCCESS - 1)
+	}
+	return C.int(git_SUCCESS)
+}
+
+func (pb *PackBuilder) ObjectCount() uint {
+	return uint(C.git_packbuilder_object_count(pb.git_packbuilder))
+}
+
+func (pb *PackBuilder) Written() uint {
+	return uint(C.git_packbuilder_written(pb.git_packbuilder))
+}
+
+// The checksum of the pack, which also names it; only valid once the pack
+// has been written.
+func (pb *PackBuilder) Hash() *Oid {
+	name := C.git_packbuilder_name(pb.git_packbuilder)
+	if name == nil {
+		return nil
+	}
+	return OidFromString(C.GoString(name))
+}
+
+// Write the pack along with its index into dir as pack-<hash>.pack and
+// pack-<hash>.idx, created with mode, 0 meaning the default. callback, if
+// not nil, reports the progress of indexing.
+func (pb *PackBuilder) WriteToDir(dir string, mode os.FileMode, callback TransferProgressCallback, payload interface{}) error {
+	cdir := C.CString(dir)
+	defer C.free(unsafe.Pointer(cdir))
+	var data C.uintptr_t
+	if callback != nil {
+		data = trackCallback(&transferProgressCallbackWrapper{callback, payload})
+		defer untrackCallback(data)
+	}
+	ecode := C.goPackbuilderWrite(pb.git_packbuilder, cdir, C.uint(mode.Perm()), data)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+type packBuilderWriter struct {
+	w   io.Writer
+	err error
+}
+
+// Generate the pack and write it to w.
+func (pb *PackBuilder) Write(w io.Writer) error {
+	writer := &packBuilderWriter{w: w}
+	data := trackCallback(writer)
+	defer untrackCallback(data)
+	ecode := C.goPackbuilderForEach(pb.git_packbuilder, data)
+	if writer.err != nil {
+		return writer.err
+	}
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+//export go_packbuilder_foreach_callback
+func go_packbuilder_foreach_callback(buf unsafe.Pointer, size C.size_t, payload C.uintptr_t) C.int {
+	writer := lookupCallback(payload).(*packBuilderWriter)
+	_, writer.err = writer.w.Write(C.GoBytes(buf, C.int(size)))
+	if writer.err != nil {
+		return C.int(git_SUCCESS - 1)
+	}
+	return C.int(git_SUCCESS)
+}
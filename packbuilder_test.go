@@ -0,0 +1,105 @@
+package git2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackBuilderWriteToDir(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	commitTestFiles(t, repo, map[string]string{"a": "a", "dir/b": "b"}, "first")
+	head := commitTestFiles(t, repo, map[string]string{"a": "changed"}, "second")
+
+	pb, err := repo.NewPackBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pb.Free()
+	if n := pb.SetThreads(2); n == 0 {
+		t.Error("no threads will be used")
+	}
+	stages := make(map[PackBuilderStage]bool)
+	err = pb.SetProgressCallback(func(stage PackBuilderStage, current, total uint, payload interface{}) error {
+		stages[stage] = true
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walk, err := repo.NewRevwalk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer walk.Free()
+	if err = walk.Push(head); err != nil {
+		t.Fatal(err)
+	}
+	if err = pb.InsertWalk(walk); err != nil {
+		t.Fatal(err)
+	}
+	// Two commits, two root trees, one tree for dir and three blobs.
+	if count := pb.ObjectCount(); count != 8 {
+		t.Errorf("%d objects inserted, want 8", count)
+	}
+
+	dir, err := ioutil.TempDir("", "git2-packbuilder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	indexed := false
+	err = pb.WriteToDir(dir, 0, func(stats IndexerStats, payload interface{}) error {
+		indexed = true
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !stages[PACKBUILDER_ADDING_OBJECTS] {
+		t.Error("no progress was reported while adding objects")
+	}
+	if !indexed {
+		t.Error("no progress was reported while indexing")
+	}
+	if written := pb.Written(); written != 8 {
+		t.Errorf("%d objects written, want 8", written)
+	}
+	hash := pb.Hash()
+	if hash == nil {
+		t.Fatal("the pack has no name")
+	}
+	for _, ext := range []string{".pack", ".idx"} {
+		if _, err = os.Stat(filepath.Join(dir, "pack-"+hash.String()+ext)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestPackBuilderDeltaSettings(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	pb, err := repo.NewPackBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pb.Free()
+
+	if err = pb.SetDeltaWindow(PACKBUILDER_DELTA_WINDOW); err != nil {
+		t.Error(err)
+	}
+	if err = pb.SetDeltaDepth(PACKBUILDER_DELTA_DEPTH); err != nil {
+		t.Error(err)
+	}
+	// Values libgit2 would ignore are refused.
+	if err = pb.SetDeltaWindow(250); err == nil {
+		t.Error("a delta window of 250 was accepted")
+	}
+	if err = pb.SetDeltaDepth(10); err == nil {
+		t.Error("a delta depth of 10 was accepted")
+	}
+}
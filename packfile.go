@@ -0,0 +1,534 @@
+package git2
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// An object as stored in a pack.
+type PackEntry struct {
+	Id *Oid
+	// As stored, OBJ_OFS_DELTA or OBJ_REF_DELTA for deltas.
+	Type ObjectType
+	// The type of the object once its deltas are applied.
+	ResolvedType ObjectType
+	// Uncompressed size of the stored data, the delta for deltas.
+	Size uint64
+	// Bytes taken up in the pack, header included.
+	PackedSize uint64
+	Offset     uint64
+	// Checksum of the packed bytes as recorded in the index, zero for
+	// version 1 indexes which do not have them.
+	CRC32 uint32
+	// Length of the delta chain, 0 for objects stored whole.
+	Depth  int
+	BaseId *Oid
+
+	id         [git_OID_RAWSZ]byte
+	baseOffset uint64
+	baseRaw    [git_OID_RAWSZ]byte
+	base       *PackEntry
+	dataOffset uint64
+}
+
+// A .pack and its .idx, opened for inspection.
+type Packfile struct {
+	PackPath     string
+	IndexPath    string
+	PackVersion  uint32
+	IndexVersion uint32
+	// Sorted by offset.
+	Entries []*PackEntry
+
+	packSize int64
+	byId     map[[git_OID_RAWSZ]byte]*PackEntry
+}
+
+// Open the pack whose index is at idxPath, the pack being the file next to
+// it with a .pack extension.
+func OpenPackfile(idxPath string) (*Packfile, error) {
+	pack := &Packfile{
+		IndexPath: idxPath,
+		PackPath:  strings.TrimSuffix(idxPath, ".idx") + ".pack",
+		byId:      make(map[[git_OID_RAWSZ]byte]*PackEntry),
+	}
+	if err := pack.readIndex(); err != nil {
+		return nil, err
+	}
+	if err := pack.readEntries(); err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+func (pack *Packfile) readIndex() error {
+	idx, err := ioutil.ReadFile(pack.IndexPath)
+	if err != nil {
+		return err
+	}
+	malformed := errors.New("git2: malformed pack index " + pack.IndexPath)
+
+	fanout := idx
+	pack.IndexVersion = 1
+	if len(idx) >= 8 && bytes.Equal(idx[:4], []byte("\377tOc")) {
+		pack.IndexVersion = binary.BigEndian.Uint32(idx[4:8])
+		if pack.IndexVersion != 2 {
+			return fmt.Errorf("git2: unsupported pack index version %d", pack.IndexVersion)
+		}
+		fanout = idx[8:]
+	}
+	if len(fanout) < 256*4 {
+		return malformed
+	}
+	count := int(binary.BigEndian.Uint32(fanout[255*4:]))
+	table := fanout[256*4:]
+
+	entries := make([]*PackEntry, count)
+	if pack.IndexVersion == 1 {
+		if len(table) < count*24+2*git_OID_RAWSZ {
+			return malformed
+		}
+		for i := range entries {
+			record := table[i*24:]
+			entry := &PackEntry{Offset: uint64(binary.BigEndian.Uint32(record))}
+			copy(entry.id[:], record[4:24])
+			entries[i] = entry
+		}
+	} else {
+		if len(table) < count*(git_OID_RAWSZ+8)+2*git_OID_RAWSZ {
+			return malformed
+		}
+		names := table
+		crcs := names[count*git_OID_RAWSZ:]
+		offsets := crcs[count*4:]
+		large := offsets[count*4:]
+		for i := range entries {
+			entry := &PackEntry{CRC32: binary.BigEndian.Uint32(crcs[i*4:])}
+			copy(entry.id[:], names[i*git_OID_RAWSZ:])
+			offset := binary.BigEndian.Uint32(offsets[i*4:])
+			if offset&0x80000000 == 0 {
+				entry.Offset = uint64(offset)
+			} else {
+				at := int(offset&0x7fffffff) * 8
+				if at+8 > len(large)-2*git_OID_RAWSZ {
+					return malformed
+				}
+				entry.Offset = binary.BigEndian.Uint64(large[at:])
+			}
+			entries[i] = entry
+		}
+	}
+
+	for _, entry := range entries {
+		entry.Id = OidFromRaw(string(entry.id[:]))
+		pack.byId[entry.id] = entry
+	}
+	sort.Sort(entriesByOffset(entries))
+	pack.Entries = entries
+	return nil
+}
+
+type entriesByOffset []*PackEntry
+
+func (e entriesByOffset) Len() int           { return len(e) }
+func (e entriesByOffset) Less(i, j int) bool { return e[i].Offset < e[j].Offset }
+func (e entriesByOffset) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+func (pack *Packfile) readEntries() error {
+	f, err := os.Open(pack.PackPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	pack.packSize = info.Size()
+	if pack.packSize < 12+git_OID_RAWSZ {
+		return errors.New("git2: truncated pack " + pack.PackPath)
+	}
+
+	var header [12]byte
+	if _, err = io.ReadFull(f, header[:]); err != nil {
+		return err
+	}
+	if !bytes.Equal(header[:4], []byte("PACK")) {
+		return errors.New("git2: not a pack " + pack.PackPath)
+	}
+	pack.PackVersion = binary.BigEndian.Uint32(header[4:8])
+	if pack.PackVersion != 2 && pack.PackVersion != 3 {
+		return fmt.Errorf("git2: unsupported pack version %d", pack.PackVersion)
+	}
+	if count := binary.BigEndian.Uint32(header[8:12]); int(count) != len(pack.Entries) {
+		return fmt.Errorf("git2: pack has %d objects, its index %d", count, len(pack.Entries))
+	}
+
+	byOffset := make(map[uint64]*PackEntry, len(pack.Entries))
+	end := uint64(pack.packSize) - git_OID_RAWSZ
+	for i := len(pack.Entries) - 1; i >= 0; i-- {
+		entry := pack.Entries[i]
+		if entry.Offset >= end {
+			return fmt.Errorf("git2: object %s lies outside the pack", entry.Id)
+		}
+		entry.PackedSize = end - entry.Offset
+		end = entry.Offset
+		byOffset[entry.Offset] = entry
+		if err = pack.readEntryHeader(f, entry); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range pack.Entries {
+		switch entry.Type {
+		case OBJ_OFS_DELTA:
+			entry.base = byOffset[entry.baseOffset]
+		case OBJ_REF_DELTA:
+			entry.base = pack.byId[entry.baseRaw]
+		}
+		if (entry.Type == OBJ_OFS_DELTA || entry.Type == OBJ_REF_DELTA) && entry.base == nil {
+			return fmt.Errorf("git2: the delta base of %s is not in the pack", entry.Id)
+		}
+		if entry.Type == OBJ_OFS_DELTA {
+			entry.BaseId = entry.base.Id
+		}
+	}
+	for _, entry := range pack.Entries {
+		if err = resolveDepth(entry, len(pack.Entries)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fill in the type, size and delta base of entry from its header.
+func (pack *Packfile) readEntryHeader(f *os.File, entry *PackEntry) error {
+	r := bufio.NewReader(io.NewSectionReader(f, int64(entry.Offset), int64(entry.PackedSize)))
+	read := uint64(0)
+	next := func() (byte, error) {
+		read++
+		return r.ReadByte()
+	}
+
+	c, err := next()
+	if err != nil {
+		return err
+	}
+	entry.Type = ObjectType((c >> 4) & 7)
+	entry.Size = uint64(c & 0x0f)
+	for shift := uint(4); c&0x80 != 0; shift += 7 {
+		if c, err = next(); err != nil {
+			return err
+		}
+		entry.Size |= uint64(c&0x7f) << shift
+	}
+
+	switch entry.Type {
+	case OBJ_COMMIT, OBJ_TREE, OBJ_BLOB, OBJ_TAG:
+		entry.ResolvedType = entry.Type
+	case OBJ_OFS_DELTA:
+		if c, err = next(); err != nil {
+			return err
+		}
+		distance := uint64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = next(); err != nil {
+				return err
+			}
+			distance = ((distance + 1) << 7) | uint64(c&0x7f)
+		}
+		if distance > entry.Offset {
+			return fmt.Errorf("git2: the delta base of %s lies outside the pack", entry.Id)
+		}
+		entry.baseOffset = entry.Offset - distance
+	case OBJ_REF_DELTA:
+		if _, err = io.ReadFull(r, entry.baseRaw[:]); err != nil {
+			return err
+		}
+		read += git_OID_RAWSZ
+		entry.BaseId = OidFromRaw(string(entry.baseRaw[:]))
+	default:
+		return fmt.Errorf("git2: object %s has invalid type %d", entry.Id, entry.Type)
+	}
+	entry.dataOffset = entry.Offset + read
+	return nil
+}
+
+// Follow the delta chain of entry down to the whole object, limit guarding
+// against cycles.
+func resolveDepth(entry *PackEntry, limit int) error {
+	whole := entry
+	for whole.base != nil {
+		if entry.Depth++; entry.Depth > limit {
+			return fmt.Errorf("git2: the delta chain of %s loops", entry.Id)
+		}
+		whole = whole.base
+	}
+	entry.ResolvedType = whole.Type
+	return nil
+}
+
+// The number of objects stored whole at index 0 and with a delta chain of
+// length n at index n, as summarised by git verify-pack -v.
+func (pack *Packfile) ChainHistogram() []int {
+	var histogram []int
+	for _, entry := range pack.Entries {
+		for len(histogram) <= entry.Depth {
+			histogram = append(histogram, 0)
+		}
+		histogram[entry.Depth]++
+	}
+	return histogram
+}
+
+func checksumFile(path string) ([]byte, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Size() < git_OID_RAWSZ {
+		return nil, nil, errors.New("git2: truncated file " + path)
+	}
+	h := sha1.New()
+	if _, err = io.CopyN(h, f, info.Size()-git_OID_RAWSZ); err != nil {
+		return nil, nil, err
+	}
+	trailer := make([]byte, git_OID_RAWSZ)
+	if _, err = io.ReadFull(f, trailer); err != nil {
+		return nil, nil, err
+	}
+	return h.Sum(nil), trailer, nil
+}
+
+// Check the checksums of the pack and its index, the CRC32 of every object
+// and that every object hashes to its id.
+func (pack *Packfile) Verify() error {
+	packSum, packTrailer, err := checksumFile(pack.PackPath)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(packSum, packTrailer) {
+		return errors.New("git2: pack checksum mismatch in " + pack.PackPath)
+	}
+	idxSum, idxTrailer, err := checksumFile(pack.IndexPath)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(idxSum, idxTrailer) {
+		return errors.New("git2: index checksum mismatch in " + pack.IndexPath)
+	}
+	idx, err := ioutil.ReadFile(pack.IndexPath)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(idx[len(idx)-2*git_OID_RAWSZ:len(idx)-git_OID_RAWSZ], packTrailer) {
+		return errors.New("git2: " + pack.IndexPath + " does not index " + pack.PackPath)
+	}
+
+	f, err := os.Open(pack.PackPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := &packObjectReader{f: f, cache: make(map[*PackEntry][]byte), pending: make(map[*PackEntry]int)}
+	for _, entry := range pack.Entries {
+		if entry.base != nil {
+			r.pending[entry.base]++
+		}
+	}
+	for _, entry := range pack.Entries {
+		if pack.IndexVersion >= 2 {
+			crc := crc32.NewIEEE()
+			if _, err = io.Copy(crc, io.NewSectionReader(f, int64(entry.Offset), int64(entry.PackedSize))); err != nil {
+				return err
+			}
+			if crc.Sum32() != entry.CRC32 {
+				return fmt.Errorf("git2: CRC32 mismatch for object %s", entry.Id)
+			}
+		}
+		data, err := r.read(entry)
+		if err != nil {
+			return err
+		}
+		h := sha1.New()
+		fmt.Fprintf(h, "%s %d\x00", ObjectType2String(entry.ResolvedType), len(data))
+		h.Write(data)
+		if !bytes.Equal(h.Sum(nil), entry.id[:]) {
+			return fmt.Errorf("git2: object %s does not match its contents", entry.Id)
+		}
+	}
+	return nil
+}
+
+// Reads objects out of a pack, keeping delta bases around until every
+// delta based on them has been read.
+type packObjectReader struct {
+	f       *os.File
+	cache   map[*PackEntry][]byte
+	pending map[*PackEntry]int
+}
+
+func (r *packObjectReader) inflate(entry *PackEntry) ([]byte, error) {
+	section := io.NewSectionReader(r.f, int64(entry.dataOffset), int64(entry.Offset+entry.PackedSize-entry.dataOffset))
+	z, err := zlib.NewReader(section)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	data, err := ioutil.ReadAll(z)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != entry.Size {
+		return nil, fmt.Errorf("git2: object %s inflates to %d bytes instead of %d", entry.Id, len(data), entry.Size)
+	}
+	return data, nil
+}
+
+func (r *packObjectReader) read(entry *PackEntry) ([]byte, error) {
+	if data, ok := r.cache[entry]; ok {
+		return data, nil
+	}
+	data, err := r.inflate(entry)
+	if err != nil {
+		return nil, err
+	}
+	if entry.base != nil {
+		base, err := r.read(entry.base)
+		if err != nil {
+			return nil, err
+		}
+		if r.pending[entry.base]--; r.pending[entry.base] <= 0 {
+			delete(r.cache, entry.base)
+		}
+		if data, err = applyDelta(base, data); err != nil {
+			return nil, fmt.Errorf("git2: object %s: %s", entry.Id, err)
+		}
+	}
+	if r.pending[entry] > 0 {
+		r.cache[entry] = data
+	}
+	return data, nil
+}
+
+func deltaSize(delta []byte) (uint64, []byte, error) {
+	size := uint64(0)
+	for shift := uint(0); ; shift += 7 {
+		if len(delta) == 0 {
+			return 0, nil, errors.New("truncated delta")
+		}
+		c := delta[0]
+		delta = delta[1:]
+		size |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return size, delta, nil
+		}
+	}
+}
+
+func applyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, delta, err := deltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != uint64(len(base)) {
+		return nil, errors.New("delta base size mismatch")
+	}
+	resultSize, delta, err := deltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, resultSize)
+	for len(delta) > 0 {
+		cmd := delta[0]
+		delta = delta[1:]
+		switch {
+		case cmd&0x80 != 0:
+			var offset, size uint64
+			for i := uint(0); i < 7; i++ {
+				if cmd&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errors.New("truncated delta")
+				}
+				if i < 4 {
+					offset |= uint64(delta[0]) << (8 * i)
+				} else {
+					size |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, errors.New("delta copies past the end of its base")
+			}
+			result = append(result, base[offset:offset+size]...)
+		case cmd != 0:
+			if int(cmd) > len(delta) {
+				return nil, errors.New("truncated delta")
+			}
+			result = append(result, delta[:cmd]...)
+			delta = delta[cmd:]
+		default:
+			return nil, errors.New("invalid delta opcode")
+		}
+	}
+	if uint64(len(result)) != resultSize {
+		return nil, errors.New("delta result size mismatch")
+	}
+	return result, nil
+}
+
+// Verify the pack and write the listing git verify-pack -v prints.
+func (pack *Packfile) WriteVerbose(w io.Writer) error {
+	if err := pack.Verify(); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for _, entry := range pack.Entries {
+		fmt.Fprintf(bw, "%s %-6s %d %d %d", entry.Id, ObjectType2String(entry.ResolvedType), entry.Size, entry.PackedSize, entry.Offset)
+		if entry.base != nil {
+			fmt.Fprintf(bw, " %d %s", entry.Depth, entry.BaseId)
+		}
+		fmt.Fprintf(bw, "\n")
+	}
+	plural := func(n int) string {
+		if n == 1 {
+			return ""
+		}
+		return "s"
+	}
+	for depth, count := range pack.ChainHistogram() {
+		if count == 0 {
+			continue
+		}
+		if depth == 0 {
+			fmt.Fprintf(bw, "non delta: %d object%s\n", count, plural(count))
+		} else {
+			fmt.Fprintf(bw, "chain length = %d: %d object%s\n", depth, count, plural(count))
+		}
+	}
+	fmt.Fprintf(bw, "%s: ok\n", pack.PackPath)
+	return bw.Flush()
+}
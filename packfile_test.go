@@ -0,0 +1,148 @@
+package git2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Pack the history of a repository holding two versions of a large file,
+// which makes for a delta, and return the path of the index.
+func writeTestPack(t *testing.T, repo *Repository, dir string) string {
+	content := strings.Repeat("a line of the file\n", 100)
+	commitTestFiles(t, repo, map[string]string{"file": content}, "first")
+	head := commitTestFiles(t, repo, map[string]string{"file": content + "one more\n"}, "second")
+
+	pb, err := repo.NewPackBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pb.Free()
+	walk, err := repo.NewRevwalk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer walk.Free()
+	if err = walk.Push(head); err != nil {
+		t.Fatal(err)
+	}
+	if err = pb.InsertWalk(walk); err != nil {
+		t.Fatal(err)
+	}
+	if err = pb.WriteToDir(dir, 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "pack-"+pb.Hash().String()+".idx")
+}
+
+func TestPackfile(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "git2-packfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idxPath := writeTestPack(t, repo, dir)
+
+	// Every object of the repository is still loose.
+	loose := make(map[string]bool)
+	err = repo.forEachLooseObject(func(id, path string, info os.FileInfo) error {
+		loose[id] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pack, err := OpenPackfile(idxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pack.PackVersion != 2 || pack.IndexVersion != 2 {
+		t.Errorf("pack version %d, index version %d", pack.PackVersion, pack.IndexVersion)
+	}
+	if len(pack.Entries) != len(loose) {
+		t.Fatalf("%d entries, want %d", len(pack.Entries), len(loose))
+	}
+	deltas, blobDeltas := 0, 0
+	for i, entry := range pack.Entries {
+		if !loose[entry.Id.String()] {
+			t.Errorf("%v is not in the repository", entry.Id)
+		}
+		if i > 0 && entry.Offset <= pack.Entries[i-1].Offset {
+			t.Errorf("%v is out of order", entry.Id)
+		}
+		if entry.Depth > 0 {
+			deltas++
+			if entry.BaseId == nil || !loose[entry.BaseId.String()] {
+				t.Errorf("%v has base %v", entry.Id, entry.BaseId)
+			}
+			if entry.ResolvedType == OBJ_BLOB {
+				blobDeltas++
+			}
+		}
+	}
+	if blobDeltas != 1 {
+		t.Errorf("%d blobs stored as deltas, want one version of the file", blobDeltas)
+	}
+	histogram := pack.ChainHistogram()
+	total, chains := 0, 0
+	for _, count := range histogram {
+		total += count
+		if count > 0 {
+			chains++
+		}
+	}
+	if total != len(pack.Entries) || histogram[0] != len(pack.Entries)-deltas {
+		t.Errorf("chain histogram %v with %d deltas", histogram, deltas)
+	}
+
+	var out bytes.Buffer
+	if err = pack.WriteVerbose(&out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(loose)+chains+1 || lines[len(lines)-1] != pack.PackPath+": ok" {
+		t.Errorf("verbose listing:\n%s", out.String())
+	}
+}
+
+func TestPackfileVerifyCorrupt(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "git2-packfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idxPath := writeTestPack(t, repo, dir)
+
+	pack, err := OpenPackfile(idxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pack.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(pack.PackPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flip the last byte of the last object's compressed data.
+	last := pack.Entries[len(pack.Entries)-1]
+	data[last.Offset+last.PackedSize-1] ^= 0xff
+	if err = os.Chmod(pack.PackPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(pack.PackPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = pack.Verify(); err == nil {
+		t.Error("a corrupt pack verified")
+	}
+}
@@ -0,0 +1,93 @@
+package git2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// The pkt-line framing of the git protocol: a four digit hex length
+// (including itself) followed by the payload, "0000" being a flush.
+const (
+	git_PKT_MAX_LEN  = 65520
+	git_PKT_FLUSH    = "0000"
+	git_SIDEBAND_MAX = git_PKT_MAX_LEN - 5
+)
+
+const (
+	git_SIDEBAND_DATA = iota + 1
+	git_SIDEBAND_PROGRESS
+	git_SIDEBAND_ERROR
+)
+
+var errPktTooLong = errors.New("git2: pkt-line too long")
+
+func writePkt(w io.Writer, data []byte) error {
+	if len(data)+4 > git_PKT_MAX_LEN {
+		return errPktTooLong
+	}
+	if _, err := fmt.Fprintf(w, "%04x", len(data)+4); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func writePktString(w io.Writer, format string, args ...interface{}) error {
+	return writePkt(w, []byte(fmt.Sprintf(format, args...)))
+}
+
+func writeFlush(w io.Writer) error {
+	_, err := io.WriteString(w, git_PKT_FLUSH)
+	return err
+}
+
+// Read a pkt-line, returning nil for a flush.
+func readPkt(r *bufio.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length, err := strconv.ParseUint(string(header[:]), 16, 16)
+	if err != nil {
+		return nil, errors.New("git2: malformed pkt-line length " + strconv.Quote(string(header[:])))
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	if length < 4 || length > git_PKT_MAX_LEN {
+		return nil, errPktTooLong
+	}
+	data := make([]byte, length-4)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Splits what is written to it into side-band packets on one band.
+type sidebandWriter struct {
+	w    io.Writer
+	band byte
+}
+
+func (sw *sidebandWriter) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		n := len(data)
+		if n > git_SIDEBAND_MAX {
+			n = git_SIDEBAND_MAX
+		}
+		packet := make([]byte, n+1)
+		packet[0] = sw.band
+		copy(packet[1:], data[:n])
+		if err := writePkt(sw.w, packet); err != nil {
+			return written, err
+		}
+		written += n
+		data = data[n:]
+	}
+	return written, nil
+}
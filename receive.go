@@ -0,0 +1,351 @@
+package git2
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Decides which of the reference updates of a push are accepted, in the
+// manner of git's pre-receive and update hooks. Both run once the pack has
+// been indexed, so the pushed objects can be looked up in repo, and before
+// any reference is changed. What is written to messages is relayed to the
+// client, which shows it prefixed with "remote:".
+//
+// Objects of rejected updates stay in the repository until they are
+// pruned.
+type ReceivePolicy interface {
+	// Called once with every update that passed the built-in checks, an
+	// error rejects all of them.
+	PreReceive(repo *Repository, updates []*RefUpdate, messages io.Writer) error
+	// Called for each update in turn, an error rejects that update only.
+	Update(repo *Repository, update *RefUpdate, messages io.Writer) error
+}
+
+func readReceiveCommands(br *bufio.Reader) ([]*RefUpdate, map[string]bool, error) {
+	var commands []*RefUpdate
+	capabilities := make(map[string]bool)
+	for {
+		line, err := readPkt(br)
+		if err == io.EOF && len(commands) == 0 {
+			return nil, capabilities, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if line == nil {
+			return commands, capabilities, nil
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if i := strings.IndexByte(text, 0); i >= 0 {
+			capabilities = parseCapabilities(text[i+1:])
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, nil, errors.New("git2: malformed receive-pack command: " + text)
+		}
+		oldId, err := parseOid(fields[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		newId, err := parseOid(fields[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		commands = append(commands, &RefUpdate{Name: fields[2], OldId: oldId, NewId: newId})
+	}
+}
+
+// Serve git-receive-pack on a connection whose references have already
+// been advertised: read the commands and the pack, then update the
+// references policy accepts and report the outcome for each. A nil policy
+// accepts every update that passes the built-in checks.
+func (repo *Repository) ReceivePack(r io.Reader, w io.Writer, policy ReceivePolicy) error {
+	br := bufio.NewReader(r)
+	commands, capabilities, err := readReceiveCommands(br)
+	if err != nil || len(commands) == 0 {
+		return err
+	}
+
+	sideband := capabilities["side-band-64k"] || capabilities["side-band"]
+	var messages io.Writer = ioutil.Discard
+	if sideband {
+		messages = &sidebandWriter{w, git_SIDEBAND_PROGRESS}
+	}
+
+	needPack := false
+	for _, cmd := range commands {
+		if !cmd.IsDelete() {
+			needPack = true
+		}
+	}
+	var unpackErr error
+	if needPack {
+		unpackErr = repo.receivePackData(br)
+	}
+
+	results := make([]string, len(commands))
+	if unpackErr != nil {
+		for i := range results {
+			results[i] = "unpacker error"
+		}
+	} else {
+		repo.receiveCommands(commands, results, capabilities["atomic"], policy, messages)
+	}
+
+	if capabilities["report-status"] {
+		var report io.Writer = w
+		if sideband {
+			report = &sidebandWriter{w, git_SIDEBAND_DATA}
+		}
+		if err = writeReceiveReport(report, commands, results, unpackErr); err != nil {
+			return err
+		}
+	}
+	if sideband {
+		if err = writeFlush(w); err != nil {
+			return err
+		}
+	}
+	return unpackErr
+}
+
+// Run the checks and the policy over commands, recording in results why
+// each refused one was refused, then apply the rest at once.
+func (repo *Repository) receiveCommands(commands []*RefUpdate, results []string, atomic bool, policy ReceivePolicy, messages io.Writer) {
+	accepted := func() []int {
+		var indices []int
+		for i := range commands {
+			if results[i] == "" {
+				indices = append(indices, i)
+			}
+		}
+		return indices
+	}
+	rejectAll := func(reason string) {
+		for _, i := range accepted() {
+			results[i] = reason
+		}
+	}
+
+	for i, cmd := range commands {
+		results[i] = repo.checkReceiveCommand(cmd)
+	}
+
+	if policy != nil {
+		var updates []*RefUpdate
+		for _, i := range accepted() {
+			updates = append(updates, commands[i])
+		}
+		if len(updates) > 0 {
+			if err := policy.PreReceive(repo, updates, messages); err != nil {
+				fmt.Fprintf(messages, "%s\n", err)
+				rejectAll("pre-receive hook declined")
+			}
+		}
+		for _, i := range accepted() {
+			if err := policy.Update(repo, commands[i], messages); err != nil {
+				fmt.Fprintf(messages, "%s\n", err)
+				results[i] = "hook declined"
+			}
+		}
+	}
+
+	indices := accepted()
+	if atomic && len(indices) < len(commands) {
+		rejectAll("atomic push failure")
+		return
+	}
+	updates := make([]*RefUpdate, len(indices))
+	for j, i := range indices {
+		updates[j] = commands[i]
+	}
+	if err := repo.UpdateRefs(updates); err != nil {
+		fmt.Fprintf(messages, "%s\n", err)
+		rejectAll("failed to update ref")
+	}
+}
+
+// The reason cmd cannot be applied, or "" when it can.
+func (repo *Repository) checkReceiveCommand(cmd *RefUpdate) string {
+	if !strings.HasPrefix(cmd.Name, "refs/") {
+		return "funny refname"
+	}
+	if cmd.IsCreate() && cmd.IsDelete() {
+		return "neither creates nor deletes"
+	}
+	if !repo.Bare() {
+		if head, err := repo.LookupReference("HEAD"); err == nil {
+			checkedOut := head.Type()&REF_SYMBOLIC != 0 && head.Target() == cmd.Name
+			head.Free()
+			if checkedOut {
+				return "branch is currently checked out"
+			}
+		}
+	}
+	if !cmd.IsDelete() {
+		odb, err := repo.Odb()
+		if err != nil {
+			return err.Error()
+		}
+		exists := odb.Exists(cmd.NewId)
+		odb.Free()
+		if !exists {
+			return "missing necessary objects"
+		}
+	}
+	if err := repo.checkRefUpdate(cmd); err != nil {
+		return "stale info"
+	}
+	return ""
+}
+
+func writeReceiveReport(w io.Writer, commands []*RefUpdate, results []string, unpackErr error) error {
+	var err error
+	if unpackErr != nil {
+		err = writePktString(w, "unpack %s\n", unpackErr)
+	} else {
+		err = writePktString(w, "unpack ok\n")
+	}
+	if err != nil {
+		return err
+	}
+	for i, cmd := range commands {
+		if results[i] == "" {
+			err = writePktString(w, "ok %s\n", cmd.Name)
+		} else {
+			err = writePktString(w, "ng %s %s\n", cmd.Name, results[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writeFlush(w)
+}
+
+// Index the pack that follows the commands into objects/pack, completing
+// thin packs with the objects already in the repository.
+func (repo *Repository) receivePackData(br *bufio.Reader) error {
+	odb, err := repo.Odb()
+	if err != nil {
+		return err
+	}
+	defer odb.Free()
+
+	stream, err := NewIndexerStream(filepath.Join(repo.Path(), "objects", "pack"), odb, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer stream.Free()
+	if err = copyPack(stream, br); err != nil {
+		return err
+	}
+	if err = stream.Close(); err != nil {
+		return err
+	}
+	return odb.Refresh()
+}
+
+// Hands every byte read through it on to w, in batches. The pack parser
+// reads nothing past the pack, so w gets exactly the pack.
+type packTee struct {
+	r   *bufio.Reader
+	w   io.Writer
+	buf []byte
+}
+
+const packTeeBatch = 64 * 1024
+
+func (tee *packTee) Read(p []byte) (int, error) {
+	n, err := tee.r.Read(p)
+	tee.buf = append(tee.buf, p[:n]...)
+	if len(tee.buf) >= packTeeBatch {
+		if flushErr := tee.flush(); flushErr != nil {
+			return n, flushErr
+		}
+	}
+	return n, err
+}
+
+// Reading byte by byte keeps the zlib readers from buffering past the end
+// of an object.
+func (tee *packTee) ReadByte() (byte, error) {
+	b, err := tee.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	tee.buf = append(tee.buf, b)
+	if len(tee.buf) >= packTeeBatch {
+		if err = tee.flush(); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+func (tee *packTee) flush() error {
+	_, err := tee.w.Write(tee.buf)
+	tee.buf = tee.buf[:0]
+	return err
+}
+
+// Copy the pack at the start of br to w, stopping after its trailer. The
+// client keeps a stateful connection open for the report, so the pack
+// cannot be read up to EOF. The objects are parsed only as far as needed
+// to find where each ends.
+func copyPack(w io.Writer, br *bufio.Reader) error {
+	tee := &packTee{r: br, w: w}
+	var header [12]byte
+	if _, err := io.ReadFull(tee, header[:]); err != nil {
+		return err
+	}
+	if string(header[:4]) != "PACK" {
+		return errors.New("git2: not a pack")
+	}
+	count := binary.BigEndian.Uint32(header[8:])
+	for i := uint32(0); i < count; i++ {
+		c, err := tee.ReadByte()
+		if err != nil {
+			return err
+		}
+		objType := ObjectType(c >> 4 & 7)
+		for c&0x80 != 0 {
+			if c, err = tee.ReadByte(); err != nil {
+				return err
+			}
+		}
+		switch objType {
+		case OBJ_OFS_DELTA:
+			for c = 0x80; c&0x80 != 0; {
+				if c, err = tee.ReadByte(); err != nil {
+					return err
+				}
+			}
+		case OBJ_REF_DELTA:
+			var base [git_OID_RAWSZ]byte
+			if _, err = io.ReadFull(tee, base[:]); err != nil {
+				return err
+			}
+		}
+		z, err := zlib.NewReader(tee)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(ioutil.Discard, z)
+		z.Close()
+		if err != nil {
+			return err
+		}
+	}
+	var trailer [git_OID_RAWSZ]byte
+	if _, err := io.ReadFull(tee, trailer[:]); err != nil {
+		return err
+	}
+	return tee.flush()
+}
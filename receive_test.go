@@ -0,0 +1,203 @@
+package git2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReceivePackZeroToZero(t *testing.T) {
+	repo, cleanup := createTestRepo(t, true)
+	defer cleanup()
+
+	var req bytes.Buffer
+	if err := writePktString(&req, "%s %s refs/heads/nothing\x00report-status\n", git_ZERO_HEX, git_ZERO_HEX); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFlush(&req); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := repo.ReceivePack(&req, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("ng refs/heads/nothing neither creates nor deletes")) {
+		t.Errorf("report was %q", out.String())
+	}
+	if _, err := repo.LookupReference("refs/heads/nothing"); !IsNotFound(err) {
+		t.Errorf("looking up the reference gave %v", err)
+	}
+}
+
+// Fails every read, like a client that keeps the connection open after the
+// pack to wait for the report.
+type openConnReader struct{}
+
+func (openConnReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read past the end of the request")
+}
+
+// A pack of commits and everything their trees hold.
+func packCommits(t *testing.T, repo *Repository, commits ...*Oid) []byte {
+	pb, err := repo.NewPackBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pb.Free()
+	for _, id := range commits {
+		if err = pb.InsertCommit(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err = pb.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Push commands, each "<old> <new> <name>", and pack to repo, returning
+// the report. The connection is left open after the request.
+func receivePack(t *testing.T, repo *Repository, policy ReceivePolicy, capabilities string, pack []byte, commands ...string) string {
+	var req bytes.Buffer
+	for i, cmd := range commands {
+		var err error
+		if i == 0 {
+			err = writePktString(&req, "%s\x00report-status %s\n", cmd, capabilities)
+		} else {
+			err = writePktString(&req, "%s\n", cmd)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeFlush(&req); err != nil {
+		t.Fatal(err)
+	}
+	req.Write(pack)
+
+	var out bytes.Buffer
+	if err := repo.ReceivePack(io.MultiReader(&req, openConnReader{}), &out, policy); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "unpack ok\n") {
+		t.Errorf("the pack was not unpacked: %q", out.String())
+	}
+	return out.String()
+}
+
+func checkReceiveReport(t *testing.T, report string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(report, line+"\n") {
+			t.Errorf("report %q lacks %q", report, line)
+		}
+	}
+}
+
+func TestReceivePackCreateUpdateDelete(t *testing.T) {
+	src, cleanupSrc := createTestRepo(t, false)
+	defer cleanupSrc()
+	first := commitTestFiles(t, src, map[string]string{"file": "one"}, "first")
+	second := commitTestFiles(t, src, map[string]string{"file": "two"}, "second")
+	repo, cleanup := createTestRepo(t, true)
+	defer cleanup()
+
+	report := receivePack(t, repo, nil, "", packCommits(t, src, first),
+		fmt.Sprintf("%s %s refs/heads/a", git_ZERO_HEX, first))
+	checkReceiveReport(t, report, "ok refs/heads/a")
+	checkReference(t, repo, "refs/heads/a", first)
+
+	// Only the new commit is sent, its parent is already there.
+	report = receivePack(t, repo, nil, "", packCommits(t, src, second),
+		fmt.Sprintf("%s %s refs/heads/a", first, second))
+	checkReceiveReport(t, report, "ok refs/heads/a")
+	checkReference(t, repo, "refs/heads/a", second)
+
+	report = receivePack(t, repo, nil, "", nil,
+		fmt.Sprintf("%s %s refs/heads/a", second, git_ZERO_HEX))
+	checkReceiveReport(t, report, "ok refs/heads/a")
+	if _, err := repo.LookupReference("refs/heads/a"); !IsNotFound(err) {
+		t.Errorf("looking up the deleted reference gave %v", err)
+	}
+}
+
+func TestReceivePackAtomic(t *testing.T) {
+	src, cleanupSrc := createTestRepo(t, false)
+	defer cleanupSrc()
+	first := commitTestFiles(t, src, map[string]string{"file": "one"}, "first")
+	second := commitTestFiles(t, src, map[string]string{"file": "two"}, "second")
+	repo, cleanup := createTestRepo(t, true)
+	defer cleanup()
+	pack := packCommits(t, src, second)
+
+	// refs/heads/y does not exist, so the push is refused as a whole.
+	report := receivePack(t, repo, nil, "atomic", pack,
+		fmt.Sprintf("%s %s refs/heads/x", git_ZERO_HEX, second),
+		fmt.Sprintf("%s %s refs/heads/y", first, second))
+	checkReceiveReport(t, report, "ng refs/heads/x atomic push failure", "ng refs/heads/y stale info")
+	if _, err := repo.LookupReference("refs/heads/x"); !IsNotFound(err) {
+		t.Errorf("refs/heads/x was created: %v", err)
+	}
+
+	// Both pass the checks, but refs/heads/a/b cannot be written once
+	// refs/heads/a is, which is then rolled back.
+	report = receivePack(t, repo, nil, "atomic", pack,
+		fmt.Sprintf("%s %s refs/heads/a", git_ZERO_HEX, second),
+		fmt.Sprintf("%s %s refs/heads/a/b", git_ZERO_HEX, second))
+	checkReceiveReport(t, report, "ng refs/heads/a failed to update ref", "ng refs/heads/a/b failed to update ref")
+	if _, err := repo.LookupReference("refs/heads/a"); !IsNotFound(err) {
+		t.Errorf("refs/heads/a was not rolled back: %v", err)
+	}
+}
+
+// Declines everything in PreReceive when declineAll is set, and updates of
+// protected in Update.
+type testReceivePolicy struct {
+	declineAll bool
+	protected  string
+}
+
+func (policy *testReceivePolicy) PreReceive(repo *Repository, updates []*RefUpdate, messages io.Writer) error {
+	if policy.declineAll {
+		return errors.New("no pushes today")
+	}
+	return nil
+}
+
+func (policy *testReceivePolicy) Update(repo *Repository, update *RefUpdate, messages io.Writer) error {
+	if update.Name == policy.protected {
+		return errors.New(update.Name + " is protected")
+	}
+	return nil
+}
+
+func TestReceivePackPolicy(t *testing.T) {
+	src, cleanupSrc := createTestRepo(t, false)
+	defer cleanupSrc()
+	head := commitTestFiles(t, src, map[string]string{"file": "one"}, "first")
+	repo, cleanup := createTestRepo(t, true)
+	defer cleanup()
+	pack := packCommits(t, src, head)
+	commands := []string{
+		fmt.Sprintf("%s %s refs/heads/a", git_ZERO_HEX, head),
+		fmt.Sprintf("%s %s refs/heads/protected", git_ZERO_HEX, head),
+	}
+
+	policy := &testReceivePolicy{declineAll: true}
+	report := receivePack(t, repo, policy, "", pack, commands...)
+	checkReceiveReport(t, report, "ng refs/heads/a pre-receive hook declined", "ng refs/heads/protected pre-receive hook declined")
+	if _, err := repo.LookupReference("refs/heads/a"); !IsNotFound(err) {
+		t.Errorf("refs/heads/a was created: %v", err)
+	}
+
+	policy = &testReceivePolicy{protected: "refs/heads/protected"}
+	report = receivePack(t, repo, policy, "", pack, commands...)
+	checkReceiveReport(t, report, "ok refs/heads/a", "ng refs/heads/protected hook declined")
+	checkReference(t, repo, "refs/heads/a", head)
+	if _, err := repo.LookupReference("refs/heads/protected"); !IsNotFound(err) {
+		t.Errorf("refs/heads/protected was created: %v", err)
+	}
+}
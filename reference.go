@@ -4,7 +4,11 @@ package git2
 // #include <git2.h>
 import "C"
 import (
-	"reflect"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"unsafe"
 )
 
@@ -39,8 +43,17 @@ func (ref *Reference) Free() {
 	C.git_reference_free(ref.git_reference)
 }
 
+// libgit2 hands back a new reference from every update, take its place.
+func (ref *Reference) replace(updated *C.git_reference) {
+	C.git_reference_free(ref.git_reference)
+	ref.git_reference = updated
+}
+
+// Whether the reference only lives in the packed-refs file.
 func (ref *Reference) IsPacked() bool {
-	return C.git_reference_is_packed(ref.git_reference) != c_FALSE
+	repo := C.GoString(C.git_repository_path(C.git_reference_owner(ref.git_reference)))
+	_, err := os.Lstat(filepath.Join(repo, ref.Name()))
+	return os.IsNotExist(err)
 }
 
 func (ref *Reference) Name() string {
@@ -49,7 +62,7 @@ func (ref *Reference) Name() string {
 
 func (ref *Reference) Oid() *Oid {
 	oid := new(Oid)
-	oid.git_oid = C.git_reference_oid(ref.git_reference)
+	oid.git_oid = C.git_reference_target(ref.git_reference)
 	if oid.git_oid == nil {
 		return nil
 	}
@@ -57,10 +70,22 @@ func (ref *Reference) Oid() *Oid {
 }
 
 func (ref *Reference) SetOid(oid *Oid) error {
-	ecode := C.git_reference_set_oid(ref.git_reference, oid.git_oid)
+	return ref.setOid(oid, "")
+}
+
+// Like SetOid, logging msg in the reflog when it is not empty.
+func (ref *Reference) setOid(oid *Oid, msg string) error {
+	var cmsg *C.char
+	if msg != "" {
+		cmsg = C.CString(msg)
+		defer C.free(unsafe.Pointer(cmsg))
+	}
+	var updated *C.git_reference
+	ecode := C.git_reference_set_target(&updated, ref.git_reference, oid.git_oid, cmsg)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
+	ref.replace(updated)
 	return nil
 }
 
@@ -74,10 +99,12 @@ func (ref *Reference) Owner() *Repository {
 }
 
 func (ref *Reference) Reload() error {
-	ecode := C.git_reference_reload(ref.git_reference)
+	var reloaded *C.git_reference
+	ecode := C.git_reference_lookup(&reloaded, C.git_reference_owner(ref.git_reference), C.git_reference_name(ref.git_reference))
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
+	ref.replace(reloaded)
 	return nil
 }
 
@@ -88,10 +115,12 @@ func (ref *Reference) Rename(newName string, force bool) error {
 	if force {
 		cforce = C.int(c_TRUE)
 	}
-	ecode := C.git_reference_rename(ref.git_reference, cnewName, cforce)
+	var renamed *C.git_reference
+	ecode := C.git_reference_rename(&renamed, ref.git_reference, cnewName, cforce, nil)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
+	ref.replace(renamed)
 	return nil
 }
 
@@ -101,20 +130,22 @@ func (ref *Reference) Resolve() (*Reference, error) {
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
-	return ref, nil
+	return resolved, nil
 }
 
 func (ref *Reference) Target() string {
-	return C.GoString(C.git_reference_target(ref.git_reference))
+	return C.GoString(C.git_reference_symbolic_target(ref.git_reference))
 }
 
 func (ref *Reference) SetTarget(target string) error {
 	ctarget := C.CString(target)
 	defer C.free(unsafe.Pointer(ctarget))
-	ecode := C.git_reference_set_target(ref.git_reference, ctarget)
+	var updated *C.git_reference
+	ecode := C.git_reference_symbolic_set_target(&updated, ref.git_reference, ctarget, nil)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
+	ref.replace(updated)
 	return nil
 }
 
@@ -130,7 +161,7 @@ func (repo *Repository) CreateOidRef(name string, oid *Oid, force bool) (*Refere
 	if force {
 		cforce = C.int(c_TRUE)
 	}
-	ecode := C.git_reference_create_oid(&ref.git_reference, repo.git_repository, cname, oid.git_oid, cforce)
+	ecode := C.git_reference_create(&ref.git_reference, repo.git_repository, cname, oid.git_oid, cforce, nil)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -147,32 +178,36 @@ func (repo *Repository) CreateSymbolicRef(name, target string, force bool) (*Ref
 	if force {
 		cforce = C.int(c_TRUE)
 	}
-	ecode := C.git_reference_create_symbolic(&ref.git_reference, repo.git_repository, cname, ctarget, cforce)
+	ecode := C.git_reference_symbolic_create(&ref.git_reference, repo.git_repository, cname, ctarget, cforce, nil)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
 	return ref, nil
 }
 
+// List the names of the references of the types in flags. Packed
+// references are direct ones, REF_PACKED adds nothing to REF_OID.
 func (repo *Repository) ListReferences(flags RefType) ([]string, error) {
-	var crefs C.git_strarray
-	defer C.git_strarray_free(&crefs)
-	ecode := C.git_reference_list(&crefs, repo.git_repository, C.uint(flags))
+	var iter *C.git_reference_iterator
+	ecode := C.git_reference_iterator_new(&iter, repo.git_repository)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
+	defer C.git_reference_iterator_free(iter)
 
-	// TODO: Find a safer way if one exists.
-	var refsSlice reflect.SliceHeader
-	length := int(crefs.count)
-	refsSlice.Data = uintptr(unsafe.Pointer(crefs.strings))
-	refsSlice.Len = length
-	refsSlice.Cap = length
-	crefStrings := *(*[]*C.char)(unsafe.Pointer(&refsSlice))
-
-	refs := make([]string, length)
-	for i := 0; i < len(crefStrings); i++ {
-		refs[i] = C.GoString(crefStrings[i])
+	var refs []string
+	for {
+		var cref *C.git_reference
+		ecode = C.git_reference_next(&cref, iter)
+		if ecode == git_ITEROVER {
+			break
+		} else if ecode != git_SUCCESS {
+			return nil, gitError()
+		}
+		if RefType(C.git_reference_type(cref))&flags != 0 {
+			refs = append(refs, C.GoString(C.git_reference_name(cref)))
+		}
+		C.git_reference_free(cref)
 	}
 	return refs, nil
 }
@@ -183,26 +218,176 @@ func (repo *Repository) LookupReference(name string) (*Reference, error) {
 	defer C.free(unsafe.Pointer(cname))
 	ecode := C.git_reference_lookup(&ref.git_reference, repo.git_repository, cname)
 	if ecode != git_SUCCESS {
-		return nil, gitError()
+		return nil, gitErrorCode(ecode)
 	}
 	return ref, nil
 }
 
 func (repo *Repository) ReferenceNameToOid(name string) (*Oid, error) {
 	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	ecode := C.git_reference_name_to_oid(oid.git_oid, repo.git_repository, cname)
+	ecode := C.git_reference_name_to_id(oid.git_oid, repo.git_repository, cname)
 	if ecode != git_SUCCESS {
-		return nil, gitError()
+		return nil, gitErrorCode(ecode)
 	}
 	return oid, nil
 }
 
 func (repo *Repository) PackAllRefs() error {
-	ecode := C.git_reference_packall(repo.git_repository)
+	var refdb *C.git_refdb
+	ecode := C.git_repository_refdb(&refdb, repo.git_repository)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	defer C.git_refdb_free(refdb)
+	ecode = C.git_refdb_compress(refdb)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
 	return nil
 }
+
+// An update of the reference Name from OldId to NewId. A zero OldId
+// creates the reference and a zero NewId deletes it.
+type RefUpdate struct {
+	Name  string
+	OldId *Oid
+	NewId *Oid
+}
+
+func (update *RefUpdate) IsCreate() bool {
+	return update.OldId.IsZero()
+}
+
+func (update *RefUpdate) IsDelete() bool {
+	return update.NewId.IsZero()
+}
+
+func (update *RefUpdate) reverse() *RefUpdate {
+	return &RefUpdate{Name: update.Name, OldId: update.NewId, NewId: update.OldId}
+}
+
+// Check that the reference is where the update expects it to be.
+func (repo *Repository) checkRefUpdate(update *RefUpdate) error {
+	if update.IsCreate() && update.IsDelete() {
+		return errors.New("git2: update of " + update.Name + " neither creates nor deletes it")
+	}
+	ref, err := repo.LookupReference(update.Name)
+	if update.IsCreate() {
+		if err == nil {
+			ref.Free()
+			return errors.New("git2: reference " + update.Name + " already exists")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer ref.Free()
+	if current := ref.Oid(); current == nil || current.Compare(update.OldId) != 0 {
+		return errors.New("git2: reference " + update.Name + " does not point at " + update.OldId.String())
+	}
+	return nil
+}
+
+// Apply update. Deleting a reference deletes its reflog too, so the reflog
+// it had is returned for undoRefUpdate to restore.
+func (repo *Repository) applyRefUpdate(update *RefUpdate) (*Reflog, error) {
+	if update.IsCreate() {
+		ref, err := repo.CreateOidRef(update.Name, update.NewId, false)
+		if err != nil {
+			return nil, err
+		}
+		ref.Free()
+		return nil, nil
+	}
+	ref, err := repo.LookupReference(update.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer ref.Free()
+	if !update.IsDelete() {
+		return nil, ref.SetOid(update.NewId)
+	}
+	reflog, err := ref.ReadReflog()
+	if err != nil {
+		return nil, err
+	}
+	if err = ref.Delete(); err != nil {
+		reflog.Free()
+		return nil, err
+	}
+	return reflog, nil
+}
+
+// Put back what applyRefUpdate did, along with the reflog of a deleted
+// reference.
+func (repo *Repository) undoRefUpdate(update *RefUpdate, reflog *Reflog) error {
+	discarded, err := repo.applyRefUpdate(update.reverse())
+	if discarded != nil {
+		discarded.Free()
+	}
+	if err != nil || reflog == nil {
+		return err
+	}
+	return reflog.write()
+}
+
+// Returned by UpdateRefs when an update failed and some of those already
+// written could not be put back, leaving the references partly updated.
+type RefRollbackError struct {
+	// Why the update failed.
+	Err error
+	// The updates which are still in place, and why undoing each failed.
+	Updates []*RefUpdate
+	Errors  []error
+}
+
+func (err *RefRollbackError) Error() string {
+	failures := make([]string, len(err.Updates))
+	for i, update := range err.Updates {
+		failures[i] = fmt.Sprintf("%s (%s)", update.Name, err.Errors[i])
+	}
+	return fmt.Sprintf("%s; could not roll back %s", err.Err, strings.Join(failures, ", "))
+}
+
+// Apply all of updates or none of them: every reference is checked against
+// its OldId before anything is written, and should writing one of them
+// fail, those already written are put back. When some cannot be put back
+// the error is a *RefRollbackError.
+func (repo *Repository) UpdateRefs(updates []*RefUpdate) error {
+	for _, update := range updates {
+		if err := repo.checkRefUpdate(update); err != nil {
+			return err
+		}
+	}
+	reflogs := make([]*Reflog, len(updates))
+	defer func() {
+		for _, reflog := range reflogs {
+			if reflog != nil {
+				reflog.Free()
+			}
+		}
+	}()
+	for i, update := range updates {
+		reflog, err := repo.applyRefUpdate(update)
+		if err == nil {
+			reflogs[i] = reflog
+			continue
+		}
+		rollbackErr := &RefRollbackError{Err: err}
+		for j := i - 1; j >= 0; j-- {
+			if undoErr := repo.undoRefUpdate(updates[j], reflogs[j]); undoErr != nil {
+				rollbackErr.Updates = append(rollbackErr.Updates, updates[j])
+				rollbackErr.Errors = append(rollbackErr.Errors, undoErr)
+			}
+		}
+		if len(rollbackErr.Updates) > 0 {
+			return rollbackErr
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package git2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func reflogMessages(t *testing.T, repo *Repository, name string) []string {
+	ref, err := repo.LookupReference(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Free()
+	reflog, err := ref.ReadReflog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reflog.Free()
+	var messages []string
+	for i := uint(0); i < reflog.Count(); i++ {
+		messages = append(messages, reflog.EntryByIndex(i).Msg())
+	}
+	return messages
+}
+
+func checkReference(t *testing.T, repo *Repository, name string, want *Oid) {
+	id, err := repo.ReferenceNameToOid(name)
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+	} else if id.Compare(want) != 0 {
+		t.Errorf("%s is at %s, want %s", name, id, want)
+	}
+}
+
+func TestUpdateRefsRollback(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	first := commitTestFiles(t, repo, map[string]string{"file": "one"}, "first")
+	second := commitTestFiles(t, repo, map[string]string{"file": "two"}, "second")
+	zero := OidFromString(git_ZERO_HEX)
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch := head.Name()
+	head.Free()
+
+	feature, err := repo.CreateOidRef("refs/heads/feature", first, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = feature.SetOid(second)
+	feature.Free()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reflog := reflogMessages(t, repo, "refs/heads/feature")
+
+	updates := []*RefUpdate{
+		{Name: "refs/heads/feature", OldId: second, NewId: zero},
+		{Name: branch, OldId: second, NewId: first},
+		// Cannot be written while the branch exists.
+		{Name: branch + "/topic", OldId: zero, NewId: first},
+	}
+	err = repo.UpdateRefs(updates)
+	if err == nil {
+		t.Fatal("the conflicting update was applied")
+	}
+	if _, ok := err.(*RefRollbackError); ok {
+		t.Errorf("the rollback failed: %v", err)
+	}
+
+	checkReference(t, repo, "refs/heads/feature", second)
+	checkReference(t, repo, branch, second)
+	if restored := reflogMessages(t, repo, "refs/heads/feature"); !reflect.DeepEqual(restored, reflog) {
+		t.Errorf("the reflog of the restored reference is %q, want %q", restored, reflog)
+	}
+}
+
+func TestUpdateRefsZeroToZero(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	commitTestFiles(t, repo, map[string]string{"file": "one"}, "first")
+	zero := OidFromString(git_ZERO_HEX)
+
+	err := repo.UpdateRefs([]*RefUpdate{{Name: "refs/heads/nothing", OldId: zero, NewId: zero}})
+	if err == nil {
+		t.Error("an update from zero to zero was applied")
+	}
+	if _, err = repo.LookupReference("refs/heads/nothing"); !IsNotFound(err) {
+		t.Errorf("looking up the reference gave %v", err)
+	}
+}
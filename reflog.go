@@ -4,6 +4,7 @@ package git2
 // #include <git2.h>
 import "C"
 import (
+	"errors"
 	"unsafe"
 )
 
@@ -15,9 +16,22 @@ func (reflog *Reflog) Count() uint {
 	return uint(C.git_reflog_entrycount(reflog.git_reflog))
 }
 
+func (reflog *Reflog) Free() {
+	C.git_reflog_free(reflog.git_reflog)
+}
+
+// Write the reflog back to disk, replacing the reference's log.
+func (reflog *Reflog) write() error {
+	ecode := C.git_reflog_write(reflog.git_reflog)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
 func (reflog *Reflog) EntryByIndex(idx uint) *ReflogEntry {
 	entry := new(ReflogEntry)
-	entry.git_reflog_entry = C.git_reflog_entry_byindex(reflog.git_reflog, C.uint(idx))
+	entry.git_reflog_entry = C.git_reflog_entry_byindex(reflog.git_reflog, C.size_t(idx))
 	return entry
 }
 
@@ -32,12 +46,12 @@ func (entry *ReflogEntry) Committer() *Signature {
 }
 
 func (entry *ReflogEntry) Msg() string {
-	return C.GoString(C.git_reflog_entry_msg(entry.git_reflog_entry))
+	return C.GoString(C.git_reflog_entry_message(entry.git_reflog_entry))
 }
 
 func (entry *ReflogEntry) NewOid() *Oid {
 	oid := new(Oid)
-	oid.git_oid = C.git_reflog_entry_oidnew(entry.git_reflog_entry)
+	oid.git_oid = C.git_reflog_entry_id_new(entry.git_reflog_entry)
 	if oid.git_oid == nil {
 		return nil
 	}
@@ -46,7 +60,7 @@ func (entry *ReflogEntry) NewOid() *Oid {
 
 func (entry *ReflogEntry) OldOid() *Oid {
 	oid := new(Oid)
-	oid.git_oid = C.git_reflog_entry_oidold(entry.git_reflog_entry)
+	oid.git_oid = C.git_reflog_entry_id_old(entry.git_reflog_entry)
 	if oid.git_oid == nil {
 		return nil
 	}
@@ -54,7 +68,7 @@ func (entry *ReflogEntry) OldOid() *Oid {
 }
 
 func (ref *Reference) DeleteReflog() error {
-	ecode := C.git_reflog_delete(ref.git_reference)
+	ecode := C.git_reflog_delete(C.git_reference_owner(ref.git_reference), C.git_reference_name(ref.git_reference))
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
@@ -63,7 +77,7 @@ func (ref *Reference) DeleteReflog() error {
 
 func (ref *Reference) ReadReflog() (*Reflog, error) {
 	reflog := new(Reflog)
-	ecode := C.git_reflog_read(&reflog.git_reflog, ref.git_reference)
+	ecode := C.git_reflog_read(&reflog.git_reflog, C.git_reference_owner(ref.git_reference), C.git_reference_name(ref.git_reference))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -73,17 +87,33 @@ func (ref *Reference) ReadReflog() (*Reflog, error) {
 func (ref *Reference) RenameReflog(newName string) error {
 	cnewName := C.CString(newName)
 	defer C.free(unsafe.Pointer(cnewName))
-	ecode := C.git_reflog_rename(ref.git_reference, cnewName)
+	ecode := C.git_reflog_rename(C.git_reference_owner(ref.git_reference), C.git_reference_name(ref.git_reference), cnewName)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
 	return nil
 }
 
+// Append an entry for the reference's current target to its reflog. The
+// entry's old id is taken from the previous entry, oldOid is only kept for
+// compatibility.
 func (ref *Reference) WriteReflog(oldOid *Oid, committer *Signature, msg string) error {
+	target := C.git_reference_target(ref.git_reference)
+	if target == nil {
+		return errors.New("git2: only direct references have a reflog to write")
+	}
+	reflog, err := ref.ReadReflog()
+	if err != nil {
+		return err
+	}
+	defer reflog.Free()
 	cmsg := C.CString(msg)
 	defer C.free(unsafe.Pointer(cmsg))
-	ecode := C.git_reflog_write(ref.git_reference, oldOid.git_oid, committer.git_signature, cmsg)
+	ecode := C.git_reflog_append(reflog.git_reflog, target, committer.git_signature, cmsg)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	ecode = C.git_reflog_write(reflog.git_reflog)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
@@ -4,6 +4,7 @@ package git2
 // #include <git2.h>
 import "C"
 import (
+	"strings"
 	"unsafe"
 )
 
@@ -28,12 +29,60 @@ func (refspec *Refspec) SourceMatches(refname string) bool {
 func (refspec *Refspec) Transform(name string) (string, error) {
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	var path [git_PATH_MAX]int8
-	cpath := (*C.char)(&path[0])
-	defer C.free(unsafe.Pointer(cpath))
-	ecode := C.git_refspec_transform(cpath, C.size_t(git_PATH_MAX), refspec.git_refspec, cname)
+	var cpath C.git_buf
+	defer C.git_buf_dispose(&cpath)
+	ecode := C.git_refspec_transform(&cpath, refspec.git_refspec, cname)
 	if ecode != git_SUCCESS {
 		return "", gitError()
 	}
-	return C.GoString(cpath), nil
+	return C.GoString(cpath.ptr), nil
+}
+
+// The parts of a refspec string, parsed on the Go side so refspecs read
+// from the configuration can be matched without a git_refspec.
+type refspecParts struct {
+	force bool
+	src   string
+	dst   string
+}
+
+func parseRefspec(spec string) refspecParts {
+	var parts refspecParts
+	if strings.HasPrefix(spec, "+") {
+		parts.force = true
+		spec = spec[1:]
+	}
+	if i := strings.Index(spec, ":"); i >= 0 {
+		parts.src, parts.dst = spec[:i], spec[i+1:]
+	} else {
+		parts.src = spec
+	}
+	return parts
+}
+
+// Match name against a pattern with at most one "*", returning what the
+// "*" stood for.
+func matchRefPattern(pattern, name string) (string, bool) {
+	i := strings.Index(pattern, "*")
+	if i < 0 {
+		return "", pattern == name
+	}
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return name[len(prefix) : len(name)-len(suffix)], true
+}
+
+// Map a local reference matching the destination back to the remote
+// reference it is fetched from.
+func (parts refspecParts) reverseTransform(name string) (string, bool) {
+	if parts.dst == "" {
+		return "", false
+	}
+	match, ok := matchRefPattern(parts.dst, name)
+	if !ok {
+		return "", false
+	}
+	return strings.Replace(parts.src, "*", match, 1), true
 }
@@ -0,0 +1,67 @@
+#include <git2.h>
+#include "_cgo_export.h"
+
+int go_remote_update_tips_callback2(const char *refname, const git_oid *a, const git_oid *b, void *data) {
+	char *vrefname = (char *)refname;
+	git_oid *va = (git_oid *)a;
+	git_oid *vb = (git_oid *)b;
+	return go_remote_update_tips_callback(vrefname, va, vb, (uintptr_t)data);
+}
+
+int go_remote_push_update_reference_callback2(const char *refname, const char *status, void *data) {
+	char *vrefname = (char *)refname;
+	char *vstatus = (char *)status;
+	return go_remote_push_update_reference_callback(vrefname, vstatus, (uintptr_t)data);
+}
+
+int go_remote_push_transfer_progress_callback2(unsigned int current, unsigned int total, size_t bytes, void *payload) {
+	return go_remote_push_transfer_progress_callback(current, total, bytes, (uintptr_t)payload);
+}
+
+int go_remote_credentials_callback2(git_credential **out, const char *url, const char *username_from_url, unsigned int allowed_types, void *payload) {
+	char *vurl = (char *)url;
+	char *vusername_from_url = (char *)username_from_url;
+	return go_remote_credentials_callback(out, vurl, vusername_from_url, allowed_types, (uintptr_t)payload);
+}
+
+int go_remote_sideband_progress_callback2(const char *str, int len, void *payload) {
+	char *vstr = (char *)str;
+	return go_remote_sideband_progress_callback(vstr, len, (uintptr_t)payload);
+}
+
+int go_remote_transfer_progress_callback2(const git_indexer_progress *stats, void *payload) {
+	git_indexer_progress *vstats = (git_indexer_progress *)stats;
+	return go_remote_transfer_progress_callback(vstats, (uintptr_t)payload);
+}
+
+int go_remote_certificate_check_callback2(git_cert *cert, int valid, const char *host, void *payload) {
+	char *vhost = (char *)host;
+	return go_remote_certificate_check_callback(cert, valid, vhost, (uintptr_t)payload);
+}
+
+void goPopulateRemoteCallbacks(git_remote_callbacks *callbacks, uintptr_t payload) {
+	git_remote_init_callbacks(callbacks, GIT_REMOTE_CALLBACKS_VERSION);
+	if (payload == 0) {
+		return;
+	}
+	callbacks->sideband_progress = go_remote_sideband_progress_callback2;
+	callbacks->credentials = go_remote_credentials_callback2;
+	callbacks->certificate_check = go_remote_certificate_check_callback2;
+	callbacks->transfer_progress = go_remote_transfer_progress_callback2;
+	callbacks->update_tips = go_remote_update_tips_callback2;
+	callbacks->push_update_reference = go_remote_push_update_reference_callback2;
+	callbacks->push_transfer_progress = go_remote_push_transfer_progress_callback2;
+	callbacks->payload = (void *)payload;
+}
+
+void goPopulateProxyOptions(git_proxy_options *opts, git_proxy_t type, const char *url, uintptr_t payload) {
+	git_proxy_options_init(opts, GIT_PROXY_OPTIONS_VERSION);
+	opts->type = type;
+	opts->url = url;
+	if (payload == 0) {
+		return;
+	}
+	opts->credentials = go_remote_credentials_callback2;
+	opts->certificate_check = go_remote_certificate_check_callback2;
+	opts->payload = (void *)payload;
+}
@@ -2,9 +2,20 @@ package git2
 
 // #cgo pkg-config: libgit2
 // #include <git2.h>
+// extern int go_remote_sideband_progress_callback(char *str, int len, uintptr_t payload);
+// extern int go_remote_transfer_progress_callback(git_indexer_progress *stats, uintptr_t payload);
+// extern int go_remote_credentials_callback(git_credential **out, char *url, char *username_from_url, unsigned int allowed_types, uintptr_t payload);
+// extern int go_remote_certificate_check_callback(git_cert *cert, int valid, char *host, uintptr_t payload);
+// extern int go_remote_update_tips_callback(char *refname, git_oid *a, git_oid *b, uintptr_t data);
+// extern int go_remote_push_update_reference_callback(char *refname, char *status, uintptr_t data);
+// extern int go_remote_push_transfer_progress_callback(unsigned int current, unsigned int total, size_t bytes, uintptr_t payload);
+// extern void goPopulateRemoteCallbacks(git_remote_callbacks *callbacks, uintptr_t payload);
+// extern void goPopulateProxyOptions(git_proxy_options *opts, git_proxy_t type, const char *url, uintptr_t payload);
 import "C"
 import (
 	"reflect"
+	"regexp"
+	"strings"
 	"unsafe"
 )
 
@@ -15,24 +26,285 @@ const (
 	DIR_PUSH
 )
 
+// Whether url is for a transport this build of libgit2 has, or one added
+// with RegisterTransport.
 func SupportedRemoteUrl(url string) bool {
-	curl := C.CString(url)
-	defer C.free(unsafe.Pointer(curl))
-	return C.git_remote_supported_url(curl) != c_FALSE
+	if !ValidRemoteUrl(url) {
+		return false
+	}
+	features := C.git_libgit2_features()
+	switch {
+	case strings.HasPrefix(url, "https://"):
+		return features&C.GIT_FEATURE_HTTPS != 0
+	case strings.HasPrefix(url, "ssh://"), isScpLikeUrl(url):
+		return features&C.GIT_FEATURE_SSH != 0
+	}
+	return true
 }
 
+// Whether url uses one of the transports git knows about, or one added with
+// RegisterTransport.
 func ValidRemoteUrl(url string) bool {
-	curl := C.CString(url)
-	defer C.free(unsafe.Pointer(curl))
-	return C.git_remote_valid_url(curl) != c_FALSE
+	for _, prefix := range []string{"git://", "http://", "https://", "ssh://", "file://"} {
+		if strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	if isScpLikeUrl(url) {
+		return true
+	}
+	transports.Lock()
+	defer transports.Unlock()
+	for prefix := range transports.prefixes {
+		if strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// The user@host:path form of ssh URLs.
+func isScpLikeUrl(url string) bool {
+	colon := strings.Index(url, ":")
+	return colon > 0 && !strings.Contains(url[:colon], "/") && !strings.HasPrefix(url[colon:], "://")
+}
+
+// Apply the url.<base>.insteadOf rules in cfg to url, using the longest
+// matching prefix. For DIR_PUSH the url.<base>.pushInsteadOf rules take
+// precedence, falling back to insteadOf when none of them match.
+func RewriteURL(cfg *Config, url string, dir Direction) (string, error) {
+	if dir == DIR_PUSH {
+		rewritten, matched, err := rewriteURL(cfg, url, "pushinsteadof")
+		if err != nil || matched {
+			return rewritten, err
+		}
+	}
+	rewritten, _, err := rewriteURL(cfg, url, "insteadof")
+	return rewritten, err
+}
+
+func rewriteURL(cfg *Config, url, key string) (string, bool, error) {
+	var base, prefix string
+	matched := false
+	suffix := "." + key
+	err := cfg.ForEach(func(name, value string, payload interface{}) error {
+		if !strings.HasPrefix(name, "url.") || !strings.HasSuffix(strings.ToLower(name), suffix) {
+			return nil
+		}
+		if strings.HasPrefix(url, value) && (!matched || len(value) > len(prefix)) {
+			base = name[len("url.") : len(name)-len(suffix)]
+			prefix = value
+			matched = true
+		}
+		return nil
+	}, nil)
+	if err != nil || !matched {
+		return url, false, err
+	}
+	return base + url[len(prefix):], true, nil
 }
 
 type Remote struct {
 	git_remote *C.git_remote
+	// Handle of the callbacks used by Connect, Download and UpdateTips, 0
+	// when none are set.
+	callbacks C.uintptr_t
+}
+
+type RemoteCallbacks struct {
+	SidebandProgress     SidebandProgressCallback
+	Credentials          CredentialsCallback
+	CertificateCheck     CertificateCheckCallback
+	TransferProgress     TransferProgressCallback
+	UpdateTips           UpdateTipsCallback
+	PushUpdateReference  PushUpdateReferenceCallback
+	PushTransferProgress PushTransferProgressCallback
+	Payload              interface{}
+}
+
+// Called with the text the server sends on the sideband, the lines git
+// prints prefixed with "remote:".
+type SidebandProgressCallback func(message string, payload interface{}) error
+
+//export go_remote_sideband_progress_callback
+func go_remote_sideband_progress_callback(str *C.char, length C.int, payload C.uintptr_t) C.int {
+	callbacks := lookupCallback(payload).(*RemoteCallbacks)
+	if callbacks.SidebandProgress == nil {
+		return C.int(git_SUCCESS)
+	}
+	err := callbacks.SidebandProgress(C.GoStringN(str, length), callbacks.Payload)
+	if err != nil {
+		return C.int(git_SUCCESS - 1)
+	}
+	return C.int(git_SUCCESS)
+}
+
+//export go_remote_transfer_progress_callback
+func go_remote_transfer_progress_callback(stats *C.git_indexer_progress, payload C.uintptr_t) C.int {
+	callbacks := lookupCallback(payload).(*RemoteCallbacks)
+	if callbacks.TransferProgress == nil {
+		return C.int(git_SUCCESS)
+	}
+	err := callbacks.TransferProgress(newIndexerStatsFromC(stats), callbacks.Payload)
+	if err != nil {
+		return C.int(git_SUCCESS - 1)
+	}
+	return C.int(git_SUCCESS)
+}
+
+//export go_remote_credentials_callback
+func go_remote_credentials_callback(out **C.git_credential, url, usernameFromURL *C.char, allowedTypes C.uint, payload C.uintptr_t) C.int {
+	callbacks := lookupCallback(payload).(*RemoteCallbacks)
+	if callbacks.Credentials == nil {
+		return C.int(git_PASSTHROUGH)
+	}
+	var username string
+	if usernameFromURL != nil {
+		username = C.GoString(usernameFromURL)
+	}
+	cred, err := callbacks.Credentials(C.GoString(url), username, CredType(allowedTypes), callbacks.Payload)
+	if err != nil {
+		setGitError(C.GIT_ERROR_NET, err)
+		return C.int(git_SUCCESS - 1)
+	}
+	if cred == nil {
+		return C.int(git_PASSTHROUGH)
+	}
+	// libgit2 takes ownership of the credential.
+	*out = cred.git_credential
+	return C.int(git_SUCCESS)
+}
+
+//export go_remote_certificate_check_callback
+func go_remote_certificate_check_callback(ccert *C.git_cert, valid C.int, host *C.char, payload C.uintptr_t) C.int {
+	callbacks := lookupCallback(payload).(*RemoteCallbacks)
+	if callbacks.CertificateCheck == nil {
+		return C.int(git_PASSTHROUGH)
+	}
+	cert, err := newCertificateFromC(ccert)
+	if err == nil {
+		err = callbacks.CertificateCheck(cert, valid != c_FALSE, C.GoString(host), callbacks.Payload)
+	}
+	if err != nil {
+		setGitError(C.GIT_ERROR_NET, err)
+		return C.int(git_SUCCESS - 1)
+	}
+	return C.int(git_SUCCESS)
+}
+
+// Called for every reference UpdateTips changes. The old id is zero for
+// newly created references.
+type UpdateTipsCallback func(refname string, oldId, newId *Oid, payload interface{}) error
+
+// Set the callbacks used by Connect, Download and UpdateTips. Fetch and Push
+// take theirs from their options.
+func (remote *Remote) SetCallbacks(callbacks *RemoteCallbacks) {
+	if remote.callbacks != 0 {
+		untrackCallback(remote.callbacks)
+		remote.callbacks = 0
+	}
+	if callbacks != nil {
+		remote.callbacks = trackCallback(callbacks)
+	}
+}
+
+//export go_remote_update_tips_callback
+func go_remote_update_tips_callback(refname *C.char, a, b *C.git_oid, data C.uintptr_t) C.int {
+	callbacks := lookupCallback(data).(*RemoteCallbacks)
+	if callbacks.UpdateTips == nil {
+		return C.int(git_SUCCESS)
+	}
+	err := callbacks.UpdateTips(C.GoString(refname), newOidFromC(a), newOidFromC(b), callbacks.Payload)
+	if err != nil {
+		return C.int(git_SUCCESS - 1)
+	}
+	return C.int(git_SUCCESS)
+}
+
+// Called with the server's verdict for every reference in a push, status is
+// empty when the update was accepted and holds the reason otherwise.
+type PushUpdateReferenceCallback func(refname, status string, payload interface{}) error
+
+//export go_remote_push_update_reference_callback
+func go_remote_push_update_reference_callback(refname, status *C.char, data C.uintptr_t) C.int {
+	callbacks := lookupCallback(data).(*RemoteCallbacks)
+	if callbacks.PushUpdateReference == nil {
+		return C.int(git_SUCCESS)
+	}
+	var goStatus string
+	if status != nil {
+		goStatus = C.GoString(status)
+	}
+	err := callbacks.PushUpdateReference(C.GoString(refname), goStatus, callbacks.Payload)
+	if err != nil {
+		return C.int(git_SUCCESS - 1)
+	}
+	return C.int(git_SUCCESS)
+}
+
+type PushTransferProgressCallback func(current, total uint, bytes uint64, payload interface{}) error
+
+//export go_remote_push_transfer_progress_callback
+func go_remote_push_transfer_progress_callback(current, total C.uint, bytes C.size_t, payload C.uintptr_t) C.int {
+	callbacks := lookupCallback(payload).(*RemoteCallbacks)
+	if callbacks.PushTransferProgress == nil {
+		return C.int(git_SUCCESS)
+	}
+	err := callbacks.PushTransferProgress(uint(current), uint(total), uint64(bytes), callbacks.Payload)
+	if err != nil {
+		return C.int(git_SUCCESS - 1)
+	}
+	return C.int(git_SUCCESS)
+}
+
+type ProxyType int
+
+const (
+	PROXY_NONE ProxyType = iota
+	// Detect the proxy from the http.proxy setting and the environment.
+	PROXY_AUTO
+	PROXY_SPECIFIED
+)
+
+type ProxyOptions struct {
+	Type ProxyType
+	// The proxy to use with PROXY_SPECIFIED.
+	Url string
+}
+
+// The proxy's credentials and certificate are checked by the Credentials
+// and CertificateCheck callbacks tracked as callbacks.
+func populateProxyOptions(copts *C.git_proxy_options, opts *ProxyOptions, callbacks C.uintptr_t) {
+	var curl *C.char
+	if opts.Url != "" {
+		curl = C.CString(opts.Url)
+	}
+	C.goPopulateProxyOptions(copts, C.git_proxy_t(opts.Type), curl, callbacks)
+}
+
+// Release the handle populateFetchOptions or populatePushOptions tracked
+// the callbacks under, which the proxy options share.
+func freeRemoteCallbacks(ccallbacks *C.git_remote_callbacks) {
+	if handle := C.uintptr_t(uintptr(ccallbacks.payload)); handle != 0 {
+		untrackCallback(handle)
+	}
+	ccallbacks.payload = nil
+}
+
+func freeProxyOptions(copts *C.git_proxy_options) {
+	C.free(unsafe.Pointer(copts.url))
+	copts.url = nil
 }
 
 func (remote *Remote) Connect(direction Direction) error {
-	ecode := C.git_remote_connect(remote.git_remote, C.int(direction))
+	return remote.connect(direction, remote.callbacks)
+}
+
+// Connect with the callbacks tracked as callbacks.
+func (remote *Remote) connect(direction Direction, callbacks C.uintptr_t) error {
+	var ccallbacks C.git_remote_callbacks
+	C.goPopulateRemoteCallbacks(&ccallbacks, callbacks)
+	ecode := C.git_remote_connect(remote.git_remote, C.git_direction(direction), &ccallbacks, nil, nil)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
@@ -47,98 +319,579 @@ func (remote *Remote) Disconnect() {
 	C.git_remote_disconnect(remote.git_remote)
 }
 
-func (remote *Remote) Download(bytes *int64, stats *IndexerStats) error {
-	ecode := C.git_remote_download(remote.git_remote, (*C.git_off_t)(bytes), stats.git_indexer_stats)
+// Download the pack for the configured fetch refspecs, progress is reported
+// through the TransferProgress callback and the final figures stored in
+// stats when it is not nil.
+func (remote *Remote) Download(stats *IndexerStats) error {
+	var copts C.git_fetch_options
+	C.git_fetch_options_init(&copts, C.GIT_FETCH_OPTIONS_VERSION)
+	C.goPopulateRemoteCallbacks(&copts.callbacks, remote.callbacks)
+	ecode := C.git_remote_download(remote.git_remote, nil, &copts)
+	if stats != nil {
+		*stats = remote.Stats()
+	}
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
 	return nil
 }
 
+// The statistics of the last download or fetch.
+func (remote *Remote) Stats() IndexerStats {
+	return newIndexerStatsFromC(C.git_remote_stats(remote.git_remote))
+}
+
+type FetchPrune int
+
+const (
+	// Prune according to remote.<name>.prune and fetch.prune.
+	FETCH_PRUNE_UNSPECIFIED FetchPrune = iota
+	FETCH_PRUNE
+	FETCH_NO_PRUNE
+)
+
+type DownloadTags int
+
+const (
+	// Use the remote's tagopt setting, auto-following by default.
+	DOWNLOAD_TAGS_UNSPECIFIED DownloadTags = iota
+	DOWNLOAD_TAGS_AUTO
+	DOWNLOAD_TAGS_NONE
+	DOWNLOAD_TAGS_ALL
+)
+
+const (
+	// Fetch the complete history.
+	FETCH_DEPTH_FULL = 0
+	// Fetch the history missing from a shallow repository.
+	FETCH_DEPTH_UNSHALLOW = 2147483647
+)
+
+type FetchOptions struct {
+	Callbacks    *RemoteCallbacks
+	ProxyOptions ProxyOptions
+	// Extra HTTP headers such as "Authorization: Bearer ...".
+	Headers      []string
+	Prune        FetchPrune
+	DownloadTags DownloadTags
+	// Do not write FETCH_HEAD.
+	SkipFetchhead bool
+	// Number of commits to fetch from each tip, making the repository
+	// shallow. Either FETCH_DEPTH_FULL or FETCH_DEPTH_UNSHALLOW fetches the
+	// whole history.
+	Depth int
+}
+
+func populateFetchOptions(copts *C.git_fetch_options, opts *FetchOptions) {
+	C.git_fetch_options_init(copts, C.GIT_FETCH_OPTIONS_VERSION)
+	if opts == nil {
+		C.goPopulateRemoteCallbacks(&copts.callbacks, 0)
+		return
+	}
+	var callbacks C.uintptr_t
+	if opts.Callbacks != nil {
+		callbacks = trackCallback(opts.Callbacks)
+	}
+	C.goPopulateRemoteCallbacks(&copts.callbacks, callbacks)
+	copts.prune = C.git_fetch_prune_t(opts.Prune)
+	copts.download_tags = C.git_remote_autotag_option_t(opts.DownloadTags)
+	if opts.SkipFetchhead {
+		copts.update_fetchhead = C.int(c_FALSE)
+	}
+	copts.depth = C.int(opts.Depth)
+	populateProxyOptions(&copts.proxy_opts, &opts.ProxyOptions, callbacks)
+	if len(opts.Headers) > 0 {
+		copts.custom_headers = *makeCStrarray(opts.Headers)
+	}
+}
+
+func freeFetchOptions(copts *C.git_fetch_options) {
+	freeRemoteCallbacks(&copts.callbacks)
+	freeProxyOptions(&copts.proxy_opts)
+	freeCStrarray(&copts.custom_headers)
+}
+
+// Connect, download, update the remote-tracking references and disconnect.
+// When refspecs is empty the remote's configured fetch refspecs are used.
+// Otherwise they replace the configured ones, but the remote-tracking
+// references the configured refspecs map the fetched references to are
+// updated as well. libgit2 1.7 has no option to turn this off. An empty
+// reflogMsg gives libgit2's default "fetch" message.
+func (remote *Remote) Fetch(refspecs []string, opts *FetchOptions, reflogMsg string) error {
+	var copts C.git_fetch_options
+	populateFetchOptions(&copts, opts)
+	defer freeFetchOptions(&copts)
+
+	crefspecs := makeCStrarray(refspecs)
+	defer freeCStrarray(crefspecs)
+	var creflogMsg *C.char
+	if reflogMsg != "" {
+		creflogMsg = C.CString(reflogMsg)
+		defer C.free(unsafe.Pointer(creflogMsg))
+	}
+
+	ecode := C.git_remote_fetch(remote.git_remote, crefspecs, &copts, creflogMsg)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+// The first fetch refspec, nil when there is none.
 func (remote *Remote) Fetchspec() *Refspec {
-	refspec := new(Refspec)
-	refspec.git_refspec = C.git_remote_fetchspec(remote.git_remote)
-	if refspec.git_refspec == nil {
-		return nil
+	return remote.firstRefspec(C.GIT_DIRECTION_FETCH)
+}
+
+func (remote *Remote) firstRefspec(direction C.git_direction) *Refspec {
+	count := C.git_remote_refspec_count(remote.git_remote)
+	for i := C.size_t(0); i < count; i++ {
+		crefspec := C.git_remote_get_refspec(remote.git_remote, i)
+		if C.git_refspec_direction(crefspec) == direction {
+			return &Refspec{crefspec}
+		}
 	}
-	return refspec
+	return nil
 }
 
 func (remote *Remote) Free() {
 	C.git_remote_free(remote.git_remote)
+	remote.SetCallbacks(nil)
+}
+
+type RemoteHead struct {
+	Name string
+	Id   *Oid
+	// The object the local reference of the same name resolves to in the
+	// remote's repository, nil when there is no such reference.
+	LocalId *Oid
+	// Target of a symbolic reference such as HEAD, empty otherwise.
+	SymrefTarget string
+	// For annotated tags, the object the tag peels to as advertised by the
+	// remote in its "^{}" entry, nil otherwise.
+	Peeled *Oid
 }
 
-/* TODO: Implement
-func (remote *Remote) Ls(callback HeadListCallback, payload interface{}) error {
+const git_PEELED_SUFFIX = "^{}"
+
+// List the references advertised by the remote, it must be connected.
+func (remote *Remote) Ls() ([]RemoteHead, error) {
+	var cheads **C.git_remote_head
+	var csize C.size_t
+	ecode := C.git_remote_ls(&cheads, &csize, remote.git_remote)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+
+	// TODO: Find a safer way if one exists.
+	var headsSlice reflect.SliceHeader
+	length := int(csize)
+	headsSlice.Data = uintptr(unsafe.Pointer(cheads))
+	headsSlice.Len = length
+	headsSlice.Cap = length
+	cheadPointers := *(*[]*C.git_remote_head)(unsafe.Pointer(&headsSlice))
+
+	// libgit2 1.x no longer fills in the heads' local ids, so resolve the
+	// local references ourselves.
+	owner := C.git_remote_owner(remote.git_remote)
+	heads := make([]RemoteHead, 0, length)
+	for _, chead := range cheadPointers {
+		name := C.GoString(chead.name)
+		id := newOidFromC(&chead.oid)
+		if strings.HasSuffix(name, git_PEELED_SUFFIX) {
+			// The peeled entry directly follows the tag it belongs to.
+			tagName := strings.TrimSuffix(name, git_PEELED_SUFFIX)
+			if n := len(heads); n > 0 && heads[n-1].Name == tagName {
+				heads[n-1].Peeled = id
+				continue
+			}
+		}
+		head := RemoteHead{Name: name, Id: id}
+		if owner != nil {
+			var cid C.git_oid
+			if C.git_reference_name_to_id(&cid, owner, chead.name) == git_SUCCESS {
+				head.LocalId = newOidFromC(&cid)
+			} else {
+				C.git_error_clear()
+			}
+		}
+		if chead.symref_target != nil {
+			head.SymrefTarget = C.GoString(chead.symref_target)
+		}
+		heads = append(heads, head)
+	}
+	return heads, nil
+}
+
+func (remote *Remote) Owner() *Repository {
+	repo := new(Repository)
+	repo.git_repository = C.git_remote_owner(remote.git_remote)
+	if repo.git_repository == nil {
+		return nil
+	}
+	return repo
 }
-*/
 
 func (remote *Remote) Name() string {
 	return C.GoString(C.git_remote_name(remote.git_remote))
 }
 
-func (remote *Remote) Pushspec() *Refspec {
-	refspec := new(Refspec)
-	refspec.git_refspec = C.git_remote_pushspec(remote.git_remote)
-	if refspec.git_refspec == nil {
-		return nil
+type PushOptions struct {
+	Callbacks    *RemoteCallbacks
+	ProxyOptions ProxyOptions
+	// Extra HTTP headers such as "Authorization: Bearer ...".
+	Headers []string
+	// Number of threads used to build the pack, 0 lets libgit2 decide.
+	PackbuilderParallelism uint
+}
+
+func populatePushOptions(copts *C.git_push_options, opts *PushOptions) {
+	C.git_push_options_init(copts, C.GIT_PUSH_OPTIONS_VERSION)
+	if opts == nil {
+		C.goPopulateRemoteCallbacks(&copts.callbacks, 0)
+		return
+	}
+	var callbacks C.uintptr_t
+	if opts.Callbacks != nil {
+		callbacks = trackCallback(opts.Callbacks)
+	}
+	C.goPopulateRemoteCallbacks(&copts.callbacks, callbacks)
+	copts.pb_parallelism = C.uint(opts.PackbuilderParallelism)
+	populateProxyOptions(&copts.proxy_opts, &opts.ProxyOptions, callbacks)
+	if len(opts.Headers) > 0 {
+		copts.custom_headers = *makeCStrarray(opts.Headers)
 	}
-	return refspec
 }
 
-func (remote *Remote) SetFetchspec(spec string) error {
-	cspec := C.CString(spec)
-	defer C.free(unsafe.Pointer(cspec))
-	ecode := C.git_remote_set_fetchspec(remote.git_remote, cspec)
+func freePushOptions(copts *C.git_push_options) {
+	freeRemoteCallbacks(&copts.callbacks)
+	freeProxyOptions(&copts.proxy_opts)
+	freeCStrarray(&copts.custom_headers)
+}
+
+// Push refspecs to the remote, falling back to the configured push refspecs
+// when refspecs is empty. A leading "+" forces an update and an empty source
+// (":refs/heads/branch") deletes the remote reference. The server's status
+// for each reference is reported through PushUpdateReference, a rejected
+// reference does not make Push fail.
+func (remote *Remote) Push(refspecs []string, opts *PushOptions) error {
+	var copts C.git_push_options
+	populatePushOptions(&copts, opts)
+	defer freePushOptions(&copts)
+
+	crefspecs := makeCStrarray(refspecs)
+	defer freeCStrarray(crefspecs)
+
+	ecode := C.git_remote_push(remote.git_remote, crefspecs, &copts)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
 	return nil
 }
 
+// Delete the remote-tracking references, as matched by the fetch refspecs,
+// whose counterpart no longer exists on the remote. Each deletion is
+// reported through callbacks.UpdateTips with a zero new id. Connects to
+// the remote with callbacks if it is not connected already. Returns the
+// names of the deleted references.
+func (remote *Remote) Prune(callbacks *RemoteCallbacks) ([]string, error) {
+	stale, err := remote.pruneDryRun(callbacks)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := remote.Owner()
+	zero := new(Oid)
+	zero.git_oid = new(C.git_oid)
+	pruned := make([]string, 0, len(stale))
+	for _, name := range stale {
+		ref, err := repo.LookupReference(name)
+		if err != nil {
+			return pruned, err
+		}
+		var oldId *Oid
+		if oid := ref.Oid(); oid != nil {
+			oldId = oid.Copy()
+		}
+		// Delete also removes the reference's reflog.
+		err = ref.Delete()
+		ref.Free()
+		if err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, name)
+		if callbacks != nil && callbacks.UpdateTips != nil {
+			if err = callbacks.UpdateTips(name, oldId, zero, callbacks.Payload); err != nil {
+				return pruned, err
+			}
+		}
+	}
+	return pruned, nil
+}
+
+// Return the references Prune would delete without deleting them.
+func (remote *Remote) PruneDryRun() ([]string, error) {
+	return remote.pruneDryRun(nil)
+}
+
+// Like PruneDryRun, connecting with callbacks when they are given and with
+// the ones set by SetCallbacks otherwise.
+func (remote *Remote) pruneDryRun(callbacks *RemoteCallbacks) ([]string, error) {
+	if !remote.Connected() {
+		handle := remote.callbacks
+		if callbacks != nil {
+			handle = trackCallback(callbacks)
+			defer untrackCallback(handle)
+		}
+		if err := remote.connect(DIR_FETCH, handle); err != nil {
+			return nil, err
+		}
+		defer remote.Disconnect()
+	}
+	heads, err := remote.Ls()
+	if err != nil {
+		return nil, err
+	}
+	advertised := make(map[string]bool, len(heads))
+	for _, head := range heads {
+		advertised[head.Name] = true
+	}
+
+	specs, err := remote.FetchRefspecs()
+	if err != nil {
+		return nil, err
+	}
+	refspecs := make([]refspecParts, len(specs))
+	for i, spec := range specs {
+		refspecs[i] = parseRefspec(spec)
+	}
+
+	// Leave symbolic references such as refs/remotes/origin/HEAD alone.
+	names, err := remote.Owner().ListReferences(REF_OID | REF_PACKED)
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for _, name := range names {
+		tracked, exists := false, false
+		for _, refspec := range refspecs {
+			if src, ok := refspec.reverseTransform(name); ok {
+				tracked = true
+				if advertised[src] {
+					exists = true
+					break
+				}
+			}
+		}
+		if tracked && !exists {
+			stale = append(stale, name)
+		}
+	}
+	return stale, nil
+}
+
+// The first push refspec, nil when there is none.
+func (remote *Remote) Pushspec() *Refspec {
+	return remote.firstRefspec(C.GIT_DIRECTION_PUSH)
+}
+
+// Replace the fetch refspecs in the remote's configuration with spec. Like
+// the other refspec changes it is only seen by remotes loaded afterwards.
+func (remote *Remote) SetFetchspec(spec string) error {
+	return remote.replaceRefspecs("fetch", spec)
+}
+
 func (remote *Remote) SetPushspec(spec string) error {
-	cspec := C.CString(spec)
-	defer C.free(unsafe.Pointer(cspec))
-	ecode := C.git_remote_set_pushspec(remote.git_remote, cspec)
+	return remote.replaceRefspecs("push", spec)
+}
+
+func (remote *Remote) replaceRefspecs(kind, spec string) error {
+	cfg, err := remote.Owner().Config()
+	if err != nil {
+		return err
+	}
+	defer cfg.Free()
+	name := "remote." + remote.Name() + "." + kind
+	if err = cfg.DeleteMultivar(name, ".*"); err != nil && !IsNotFound(err) {
+		return err
+	}
+	return cfg.SetMultivar(name, "^$", spec)
+}
+
+// Remotes are written to the configuration as they are created and
+// changed, there is nothing left for Save to do.
+func (remote *Remote) Save() error {
+	return nil
+}
+
+// Update the remote-tracking references according to the fetch refspec
+// after a Download, writing FETCH_HEAD and reflog entries. A non-nil
+// callbacks replaces the callbacks set on the remote.
+func (remote *Remote) UpdateTips(callbacks *RemoteCallbacks) error {
+	if callbacks != nil {
+		remote.SetCallbacks(callbacks)
+	}
+	var ccallbacks C.git_remote_callbacks
+	C.goPopulateRemoteCallbacks(&ccallbacks, remote.callbacks)
+	ecode := C.git_remote_update_tips(remote.git_remote, &ccallbacks, C.int(c_TRUE), C.GIT_REMOTE_DOWNLOAD_TAGS_UNSPECIFIED, nil)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
 	return nil
 }
 
-func (remote *Remote) Save() error {
-	ecode := C.git_remote_save(remote.git_remote)
+func (remote *Remote) Url() string {
+	return C.GoString(C.git_remote_url(remote.git_remote))
+}
+
+func (remote *Remote) PushUrl() string {
+	return C.GoString(C.git_remote_pushurl(remote.git_remote))
+}
+
+// The URL as written in remote.<name>.url, before insteadOf rewriting.
+// Empty for remotes which are not in the configuration.
+func (remote *Remote) ConfiguredUrl() (string, error) {
+	return remote.configValue("url")
+}
+
+// The URL as written in remote.<name>.pushurl, before pushInsteadOf
+// rewriting.
+func (remote *Remote) ConfiguredPushUrl() (string, error) {
+	return remote.configValue("pushurl")
+}
+
+func (remote *Remote) configValue(key string) (string, error) {
+	cfg, err := remote.Owner().Config()
+	if err != nil {
+		return "", err
+	}
+	defer cfg.Free()
+	value, err := cfg.GetString("remote." + remote.Name() + "." + key)
+	if IsNotFound(err) {
+		// Missing entries are not an error here.
+		return "", nil
+	}
+	return value, err
+}
+
+// The URL used to talk to the remote in direction dir, after insteadOf and
+// pushInsteadOf rewriting. Pushes go to the push URL when there is one and
+// to the pushInsteadOf rewritten URL otherwise.
+func (remote *Remote) EffectiveUrl(dir Direction) (string, error) {
+	if dir == DIR_FETCH {
+		return remote.Url(), nil
+	}
+	if pushUrl := remote.PushUrl(); pushUrl != "" {
+		return pushUrl, nil
+	}
+	url, err := remote.ConfiguredUrl()
+	if err != nil {
+		return "", err
+	}
+	if url == "" {
+		url = remote.Url()
+	}
+	cfg, err := remote.Owner().Config()
+	if err != nil {
+		return "", err
+	}
+	defer cfg.Free()
+	return RewriteURL(cfg, url, DIR_PUSH)
+}
+
+func (remote *Remote) FetchRefspecs() ([]string, error) {
+	var crefspecs C.git_strarray
+	defer C.git_strarray_dispose(&crefspecs)
+	ecode := C.git_remote_get_fetch_refspecs(&crefspecs, remote.git_remote)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return goStrings(&crefspecs), nil
+}
+
+func (remote *Remote) PushRefspecs() ([]string, error) {
+	var crefspecs C.git_strarray
+	defer C.git_strarray_dispose(&crefspecs)
+	ecode := C.git_remote_get_push_refspecs(&crefspecs, remote.git_remote)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return goStrings(&crefspecs), nil
+}
+
+// Add a fetch refspec to the remote's configuration. Like the other refspec
+// changes it is not seen by this Remote, only by ones loaded afterwards.
+func (remote *Remote) AddFetchRefspec(refspec string) error {
+	cname := C.CString(remote.Name())
+	defer C.free(unsafe.Pointer(cname))
+	crefspec := C.CString(refspec)
+	defer C.free(unsafe.Pointer(crefspec))
+	ecode := C.git_remote_add_fetch(C.git_remote_owner(remote.git_remote), cname, crefspec)
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
 	return nil
 }
 
-/* TODO: Implement
-func (remote *Remote) UpdateTips(callback UpdateTipCallback) error {
+func (remote *Remote) AddPushRefspec(refspec string) error {
+	cname := C.CString(remote.Name())
+	defer C.free(unsafe.Pointer(cname))
+	crefspec := C.CString(refspec)
+	defer C.free(unsafe.Pointer(crefspec))
+	ecode := C.git_remote_add_push(C.git_remote_owner(remote.git_remote), cname, crefspec)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
 }
-*/
 
-func (remote *Remote) Url() string {
-	return C.GoString(C.git_remote_url(remote.git_remote))
+func (remote *Remote) RemoveFetchRefspec(refspec string) error {
+	return remote.removeRefspec("fetch", refspec)
 }
 
+func (remote *Remote) RemovePushRefspec(refspec string) error {
+	return remote.removeRefspec("push", refspec)
+}
+
+// libgit2 has no call for removing a single refspec, so delete the matching
+// value of remote.<name>.<kind> from the configuration.
+func (remote *Remote) removeRefspec(kind, refspec string) error {
+	cfg, err := remote.Owner().Config()
+	if err != nil {
+		return err
+	}
+	defer cfg.Free()
+	name := "remote." + remote.Name() + "." + kind
+	return cfg.DeleteMultivar(name, "^"+regexp.QuoteMeta(refspec)+"$")
+}
+
+// The remote's URLs have url.<base>.insteadOf and pushInsteadOf rewriting
+// applied, ConfiguredUrl and ConfiguredPushUrl return them as written.
 func (repo *Repository) AddRemote(name, url string) (*Remote, error) {
 	remote := new(Remote)
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 	curl := C.CString(url)
 	defer C.free(unsafe.Pointer(curl))
-	ecode := C.git_remote_add(&remote.git_remote, repo.git_repository, cname, curl)
+	ecode := C.git_remote_create(&remote.git_remote, repo.git_repository, cname, curl)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
-	return remote, nil
+	return remote.detectBundle()
+}
+
+func (repo *Repository) DeleteRemote(name string) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	ecode := C.git_remote_delete(repo.git_repository, cname)
+	if ecode != git_SUCCESS {
+		return gitErrorCode(ecode)
+	}
+	return nil
 }
 
 func (repo *Repository) ListRemotes() ([]string, error) {
 	var cremotes C.git_strarray
-	defer C.git_strarray_free(&cremotes)
+	defer C.git_strarray_dispose(&cremotes)
 	ecode := C.git_remote_list(&cremotes, repo.git_repository)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
@@ -160,28 +913,102 @@ func (repo *Repository) ListRemotes() ([]string, error) {
 	return remotes, nil
 }
 
+// Like AddRemote, the URLs of the loaded remote are rewritten according to
+// insteadOf and pushInsteadOf.
 func (repo *Repository) LoadRemote(name string) (*Remote, error) {
 	remote := new(Remote)
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
-	ecode := C.git_remote_load(&remote.git_remote, repo.git_repository, cname)
+	ecode := C.git_remote_lookup(&remote.git_remote, repo.git_repository, cname)
 	if ecode != git_SUCCESS {
-		return nil, gitError()
+		return nil, gitErrorCode(ecode)
 	}
-	return remote, nil
+	return remote.detectBundle()
 }
 
-func (repo *Repository) NewRemote(name, url, fetch string) (*Remote, error) {
-	remote := new(Remote)
+// Rename a remote along with its configuration and remote-tracking
+// references. The returned refspecs are the non-default ones which could
+// not be rewritten and have to be updated by hand.
+func (repo *Repository) RenameRemote(name, newName string) ([]string, error) {
+	var cproblems C.git_strarray
+	defer C.git_strarray_dispose(&cproblems)
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	cnewName := C.CString(newName)
+	defer C.free(unsafe.Pointer(cnewName))
+	ecode := C.git_remote_rename(&cproblems, repo.git_repository, cname, cnewName)
+	if ecode != git_SUCCESS {
+		return nil, gitErrorCode(ecode)
+	}
+	return goStrings(&cproblems), nil
+}
+
+func (repo *Repository) SetRemoteURL(name, url string) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	curl := C.CString(url)
+	defer C.free(unsafe.Pointer(curl))
+	ecode := C.git_remote_set_url(repo.git_repository, cname, curl)
+	if ecode != git_SUCCESS {
+		return gitErrorCode(ecode)
+	}
+	return nil
+}
+
+func (repo *Repository) SetRemotePushURL(name, url string) error {
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 	curl := C.CString(url)
 	defer C.free(unsafe.Pointer(curl))
-	cfetch := C.CString(fetch)
-	defer C.free(unsafe.Pointer(cfetch))
-	ecode := C.git_remote_new(&remote.git_remote, repo.git_repository, cname, curl, cfetch)
+	ecode := C.git_remote_set_pushurl(repo.git_repository, cname, curl)
+	if ecode != git_SUCCESS {
+		return gitErrorCode(ecode)
+	}
+	return nil
+}
+
+// Create a remote fetching with the refspec fetch, or the default one when
+// it is empty. Remotes without a name are not saved to the configuration.
+// The URL is rewritten according to insteadOf like AddRemote.
+func (repo *Repository) NewRemote(name, url, fetch string) (*Remote, error) {
+	remote := new(Remote)
+	curl := C.CString(url)
+	defer C.free(unsafe.Pointer(curl))
+	var ecode C.int
+	if name == "" {
+		ecode = C.git_remote_create_anonymous(&remote.git_remote, repo.git_repository, curl)
+	} else {
+		cname := C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+		if fetch == "" {
+			ecode = C.git_remote_create(&remote.git_remote, repo.git_repository, cname, curl)
+		} else {
+			cfetch := C.CString(fetch)
+			defer C.free(unsafe.Pointer(cfetch))
+			ecode = C.git_remote_create_with_fetchspec(&remote.git_remote, repo.git_repository, cname, curl, cfetch)
+		}
+	}
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
+	return remote.detectBundle()
+}
+
+// When the remote's URL is the path of a bundle file, talk to it through
+// the bundle transport. Only this instance changes, the configuration
+// keeps the plain path.
+func (remote *Remote) detectBundle() (*Remote, error) {
+	url := remote.Url()
+	if !isBundleFile(url) {
+		return remote, nil
+	}
+	curl := C.CString(BUNDLE_URL_PREFIX + url)
+	defer C.free(unsafe.Pointer(curl))
+	ecode := C.git_remote_set_instance_url(remote.git_remote, curl)
+	if ecode != git_SUCCESS {
+		err := gitError()
+		remote.Free()
+		return nil, err
+	}
 	return remote, nil
 }
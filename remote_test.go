@@ -0,0 +1,464 @@
+package git2
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRemotePrune(t *testing.T) {
+	src, head, path, cleanup := createCloneSource(t)
+	defer cleanup()
+
+	target, err := src.LookupObject(head, OBJ_COMMIT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Free()
+	if _, err = src.CreateBranch("feature", target, false); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := Clone(src.Workdir(), path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Free()
+	if err = src.DeleteBranch("feature", BRANCH_LOCAL); err != nil {
+		t.Fatal(err)
+	}
+
+	remote, err := repo.LoadRemote("origin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Free()
+
+	stale, err := remote.PruneDryRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0] != "refs/remotes/origin/feature" {
+		t.Fatalf("stale references are %v", stale)
+	}
+
+	var updates []string
+	callbacks := &RemoteCallbacks{
+		UpdateTips: func(refname string, oldId, newId *Oid, payload interface{}) error {
+			if oldId == nil || oldId.Compare(head) != 0 || !newId.IsZero() {
+				t.Errorf("%s updated from %v to %v", refname, oldId, newId)
+			}
+			updates = append(updates, refname)
+			return nil
+		},
+	}
+	pruned, err := remote.Prune(callbacks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0] != "refs/remotes/origin/feature" {
+		t.Errorf("pruned %v", pruned)
+	}
+	if len(updates) != 1 {
+		t.Errorf("UpdateTips was called for %v", updates)
+	}
+	if _, err = repo.LookupReference("refs/remotes/origin/feature"); !IsNotFound(err) {
+		t.Errorf("looking up the pruned reference gave %v", err)
+	}
+}
+
+func TestRemoteInsteadOf(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.Free()
+	if err = cfg.SetString("url.https://example.com/.insteadOf", "ex:"); err != nil {
+		t.Fatal(err)
+	}
+	if err = cfg.SetString("url.ssh://git@example.com/.pushInsteadOf", "ex:"); err != nil {
+		t.Fatal(err)
+	}
+
+	// libgit2 applies insteadOf itself when remotes are created or looked
+	// up, so Url is already rewritten.
+	added, err := repo.AddRemote("origin", "ex:repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer added.Free()
+	created, err := repo.NewRemote("", "ex:other.git", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer created.Free()
+	if url := created.Url(); url != "https://example.com/other.git" {
+		t.Errorf("anonymous remote URL is %q", url)
+	}
+	remote, err := repo.LoadRemote("origin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Free()
+	for _, r := range []*Remote{added, remote} {
+		if url := r.Url(); url != "https://example.com/repo.git" {
+			t.Errorf("remote URL is %q", url)
+		}
+	}
+
+	if url, err := remote.ConfiguredUrl(); err != nil || url != "ex:repo.git" {
+		t.Errorf("ConfiguredUrl gave %q, %v", url, err)
+	}
+	if url, err := remote.ConfiguredPushUrl(); err != nil || url != "" {
+		t.Errorf("ConfiguredPushUrl gave %q, %v", url, err)
+	}
+	if url, err := remote.EffectiveUrl(DIR_FETCH); err != nil || url != "https://example.com/repo.git" {
+		t.Errorf("fetch URL is %q, %v", url, err)
+	}
+	if url, err := remote.EffectiveUrl(DIR_PUSH); err != nil || url != "ssh://git@example.com/repo.git" {
+		t.Errorf("push URL is %q, %v", url, err)
+	}
+}
+
+func TestRemotePush(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	dest, destCleanup := createTestRepo(t, true)
+	defer destCleanup()
+
+	head := commitTestFiles(t, repo, map[string]string{"a": "a\n"}, "first")
+	remote, err := repo.AddRemote("dest", dest.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Free()
+
+	statuses := make(map[string]string)
+	opts := &PushOptions{
+		Callbacks: &RemoteCallbacks{
+			PushUpdateReference: func(refname, status string, payload interface{}) error {
+				statuses[refname] = status
+				return nil
+			},
+		},
+	}
+	err = remote.Push([]string{"HEAD:refs/heads/pushed"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, ok := statuses["refs/heads/pushed"]; !ok || status != "" {
+		t.Fatalf("push statuses %v", statuses)
+	}
+	id, err := dest.ReferenceNameToOid("refs/heads/pushed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Compare(head) != 0 {
+		t.Errorf("pushed %v, want %v", id, head)
+	}
+
+	statuses = make(map[string]string)
+	if err = remote.Push([]string{":refs/heads/pushed"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if status, ok := statuses["refs/heads/pushed"]; !ok || status != "" {
+		t.Fatalf("delete statuses %v", statuses)
+	}
+	if _, err = dest.ReferenceNameToOid("refs/heads/pushed"); !IsNotFound(err) {
+		t.Errorf("the pushed branch is still there: %v", err)
+	}
+}
+
+// The name of the branch HEAD points at.
+func headBranch(t *testing.T, repo *Repository) string {
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer head.Free()
+	return head.Name()
+}
+
+// Tag head in src as v1 with an annotated tag, returning the tag's id.
+func tagTestHead(t *testing.T, src *Repository, head *Oid) *Oid {
+	target, err := src.LookupObject(head, OBJ_COMMIT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Free()
+	sig := testSignature(t)
+	defer sig.Free()
+	tagId, err := src.CreateTag("v1", target, sig, "version 1\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tagId
+}
+
+func TestRemoteLs(t *testing.T) {
+	src, head, _, cleanup := createCloneSource(t)
+	defer cleanup()
+	tagId := tagTestHead(t, src, head)
+	branch := headBranch(t, src)
+
+	repo, repoCleanup := createTestRepo(t, false)
+	defer repoCleanup()
+	remote, err := repo.AddRemote("origin", src.Workdir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Free()
+	if err = remote.Connect(DIR_FETCH); err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Disconnect()
+
+	heads, err := remote.Ls()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]RemoteHead)
+	for _, h := range heads {
+		byName[h.Name] = h
+	}
+	if len(byName) != 3 {
+		t.Errorf("advertised %v", heads)
+	}
+	if h := byName["HEAD"]; h.Id == nil || h.Id.Compare(head) != 0 || h.SymrefTarget != branch {
+		t.Errorf("HEAD advertised as %+v, want %v pointing at %s", h, head, branch)
+	}
+	if h := byName[branch]; h.Id == nil || h.Id.Compare(head) != 0 || h.LocalId != nil {
+		t.Errorf("%s advertised as %+v", branch, h)
+	}
+	if h := byName["refs/tags/v1"]; h.Id == nil || h.Id.Compare(tagId) != 0 || h.Peeled == nil || h.Peeled.Compare(head) != 0 {
+		t.Errorf("the tag advertised as %+v, want %v peeling to %v", h, tagId, head)
+	}
+	if _, ok := byName["refs/tags/v1^{}"]; ok {
+		t.Error("the peeled tag is listed on its own")
+	}
+}
+
+func TestRemoteLsLocalId(t *testing.T) {
+	src, head, _, cleanup := createCloneSource(t)
+	defer cleanup()
+	tagTestHead(t, src, head)
+	branch := headBranch(t, src)
+
+	repo, repoCleanup := createTestRepo(t, false)
+	defer repoCleanup()
+	local := commitTestFiles(t, repo, map[string]string{"file": "local"}, "local")
+	if name := headBranch(t, repo); name != branch {
+		t.Fatalf("the local branch is %s, want %s", name, branch)
+	}
+	remote, err := repo.AddRemote("origin", src.Workdir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Free()
+	if err = remote.Connect(DIR_FETCH); err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Disconnect()
+
+	heads, err := remote.Ls()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range heads {
+		switch h.Name {
+		case "HEAD", branch:
+			if h.LocalId == nil || h.LocalId.Compare(local) != 0 {
+				t.Errorf("%s has local id %v, want %s", h.Name, h.LocalId, local)
+			}
+		default:
+			if h.LocalId != nil {
+				t.Errorf("%s has local id %s, want none", h.Name, h.LocalId)
+			}
+		}
+	}
+}
+
+func TestRemoteUpdateTips(t *testing.T) {
+	src, head, _, cleanup := createCloneSource(t)
+	defer cleanup()
+	tracking := "refs/remotes/origin/" + strings.TrimPrefix(headBranch(t, src), "refs/heads/")
+
+	repo, repoCleanup := createTestRepo(t, false)
+	defer repoCleanup()
+	remote, err := repo.AddRemote("origin", src.Workdir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Free()
+	if err = remote.Connect(DIR_FETCH); err != nil {
+		t.Fatal(err)
+	}
+	var stats IndexerStats
+	err = remote.Download(&stats)
+	remote.Disconnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalObjects == 0 || stats.ReceivedObjects != stats.TotalObjects {
+		t.Errorf("download stats %+v", stats)
+	}
+	if _, err = repo.ReferenceNameToOid(tracking); !IsNotFound(err) {
+		t.Fatalf("%s exists before UpdateTips: %v", tracking, err)
+	}
+
+	updates := make(map[string]*Oid)
+	err = remote.UpdateTips(&RemoteCallbacks{
+		UpdateTips: func(refname string, oldId, newId *Oid, payload interface{}) error {
+			updates[refname] = newId.Copy()
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := updates[tracking]; id == nil || id.Compare(head) != 0 {
+		t.Errorf("updates %v, want %s at %v", updates, tracking, head)
+	}
+	id, err := repo.ReferenceNameToOid(tracking)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Compare(head) != 0 {
+		t.Errorf("%s is %v, want %v", tracking, id, head)
+	}
+}
+
+func TestRemoteFetch(t *testing.T) {
+	src, head, _, cleanup := createCloneSource(t)
+	defer cleanup()
+	tagId := tagTestHead(t, src, head)
+	branch := strings.TrimPrefix(headBranch(t, src), "refs/heads/")
+
+	repo, repoCleanup := createTestRepo(t, false)
+	defer repoCleanup()
+	remote, err := repo.AddRemote("origin", src.Workdir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Free()
+
+	// The refspecs given replace the configured ones. libgit2 1.7 still
+	// updates the remote-tracking branches the configured refspecs map the
+	// fetched branches to, like git's opportunistic updates.
+	opts := &FetchOptions{DownloadTags: DOWNLOAD_TAGS_NONE}
+	err = remote.Fetch([]string{"refs/heads/*:refs/remotes/other/*"}, opts, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReference(t, repo, "refs/remotes/other/"+branch, head)
+	tracking := "refs/remotes/origin/" + branch
+	checkReference(t, repo, tracking, head)
+	if _, err = repo.ReferenceNameToOid("refs/tags/v1"); !IsNotFound(err) {
+		t.Errorf("the tag was fetched: %v", err)
+	}
+
+	// Move the branch so that the next fetch updates the tracking branch.
+	next := commitTestFiles(t, src, map[string]string{"file": "changed"}, "second")
+	opts.DownloadTags = DOWNLOAD_TAGS_ALL
+	if err = remote.Fetch(nil, opts, "test fetch"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := repo.ReferenceNameToOid("refs/tags/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Compare(tagId) != 0 {
+		t.Errorf("fetched the tag as %v, want %v", id, tagId)
+	}
+	checkReference(t, repo, tracking, next)
+	// Only the configured refspecs were used this time.
+	checkReference(t, repo, "refs/remotes/other/"+branch, head)
+	if messages := reflogMessages(t, repo, tracking); len(messages) != 2 || messages[0] != "test fetch" {
+		t.Errorf("reflog of %s is %q", tracking, messages)
+	}
+}
+
+func TestRemoteConfiguration(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+
+	remote, err := repo.AddRemote("origin", "https://example.com/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = remote.AddFetchRefspec("+refs/tags/*:refs/tags/*"); err != nil {
+		t.Fatal(err)
+	}
+	if err = remote.AddPushRefspec("refs/heads/a:refs/heads/a"); err != nil {
+		t.Fatal(err)
+	}
+	if err = remote.AddPushRefspec("refs/heads/b:refs/heads/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err = remote.RemovePushRefspec("refs/heads/a:refs/heads/a"); err != nil {
+		t.Fatal(err)
+	}
+	remote.Free()
+	if err = repo.SetRemoteURL("origin", "https://example.com/moved.git"); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.SetRemotePushURL("origin", "ssh://example.com/moved.git"); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := repo.RenameRemote("origin", "upstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("rename problems %v", problems)
+	}
+	remotes, err := repo.ListRemotes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remotes) != 1 || remotes[0] != "upstream" {
+		t.Fatalf("remotes %v", remotes)
+	}
+
+	remote, err = repo.LoadRemote("upstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Free()
+	if remote.Url() != "https://example.com/moved.git" {
+		t.Errorf("url %q", remote.Url())
+	}
+	if remote.PushUrl() != "ssh://example.com/moved.git" {
+		t.Errorf("push url %q", remote.PushUrl())
+	}
+	fetch, err := remote.FetchRefspecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFetch := []string{"+refs/heads/*:refs/remotes/upstream/*", "+refs/tags/*:refs/tags/*"}
+	if strings.Join(fetch, " ") != strings.Join(wantFetch, " ") {
+		t.Errorf("fetch refspecs %q, want %q", fetch, wantFetch)
+	}
+	push, err := remote.PushRefspecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(push) != 1 || push[0] != "refs/heads/b:refs/heads/b" {
+		t.Errorf("push refspecs %q", push)
+	}
+
+	if err = repo.DeleteRemote("upstream"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.LoadRemote("upstream"); !IsNotFound(err) {
+		t.Errorf("the deleted remote loads: %v", err)
+	}
+	if err = repo.DeleteRemote("upstream"); !IsNotFound(err) {
+		t.Errorf("deleting the deleted remote: %v", err)
+	}
+	if _, err = repo.RenameRemote("upstream", "origin"); !IsNotFound(err) {
+		t.Errorf("renaming the deleted remote: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package git2
 
 // #cgo pkg-config: libgit2
 // #include <git2.h>
+// #include <git2/sys/repository.h>
 import "C"
 import (
 	"strings"
@@ -12,8 +13,8 @@ func Discover(start string, across_fs bool, ceilings []string) (string, error) {
 	cstart := C.CString(start)
 	defer C.free(unsafe.Pointer(cstart))
 
-	var path [git_PATH_MAX]int8
-	cpath := (*C.char)(&path[0])
+	var cpath C.git_buf
+	defer C.git_buf_dispose(&cpath)
 
 	cacross_fs := C.int(c_FALSE)
 	if across_fs {
@@ -24,11 +25,11 @@ func Discover(start string, across_fs bool, ceilings []string) (string, error) {
 	cceiling_dirs := C.CString(ceiling_dirs)
 	defer C.free(unsafe.Pointer(cceiling_dirs))
 
-	ecode := C.git_repository_discover(cpath, git_PATH_MAX, cstart, cacross_fs, nil)
+	ecode := C.git_repository_discover(&cpath, cstart, cacross_fs, cceiling_dirs)
 	if ecode != git_SUCCESS {
 		return "", gitError()
 	}
-	return C.GoString(cpath), nil
+	return C.GoString(cpath.ptr), nil
 }
 
 func InitRepository(path string, bare bool) (*Repository, error) {
@@ -74,8 +75,12 @@ func (repo *Repository) Free() {
 	C.git_repository_free(repo.git_repository)
 }
 
-func (repo *Repository) SetConfig(config *Config) {
-	C.git_repository_set_config(repo.git_repository, config.git_config)
+func (repo *Repository) SetConfig(config *Config) error {
+	ecode := C.git_repository_set_config(repo.git_repository, config.git_config)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
 }
 
 func (repo *Repository) Path() string {
@@ -102,7 +107,7 @@ func (repo *Repository) Detached() (bool, error) {
 }
 
 func (repo *Repository) Orphan() (bool, error) {
-	orphan := C.git_repository_head_orphan(repo.git_repository)
+	orphan := C.git_repository_head_unborn(repo.git_repository)
 	if orphan == c_TRUE {
 		return true, nil
 	} else if orphan == c_FALSE {
@@ -120,8 +125,12 @@ func (repo *Repository) Index() (*Index, error) {
 	return index, nil
 }
 
-func (repo *Repository) SetIndex(index *Index) {
-	C.git_repository_set_index(repo.git_repository, index.git_index)
+func (repo *Repository) SetIndex(index *Index) error {
+	ecode := C.git_repository_set_index(repo.git_repository, index.git_index)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
 }
 
 func (repo *Repository) Bare() bool {
@@ -141,8 +150,12 @@ func (repo *Repository) Odb() (*Odb, error) {
 	return odb, nil
 }
 
-func (repo *Repository) SetOdb(odb *Odb) {
-	C.git_repository_set_odb(repo.git_repository, odb.git_odb)
+func (repo *Repository) SetOdb(odb *Odb) error {
+	ecode := C.git_repository_set_odb(repo.git_repository, odb.git_odb)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
 }
 
 func (repo *Repository) Workdir() string {
@@ -152,7 +165,7 @@ func (repo *Repository) Workdir() string {
 func (repo *Repository) SetWorkdir(path string) error {
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
-	ecode := C.git_repository_set_workdir(repo.git_repository, cpath)
+	ecode := C.git_repository_set_workdir(repo.git_repository, cpath, C.int(c_FALSE))
 	if ecode != git_SUCCESS {
 		return gitError()
 	}
@@ -0,0 +1,255 @@
+package git2
+
+// #cgo pkg-config: libgit2
+// #include <git2.h>
+import "C"
+import (
+	"errors"
+	"path"
+	"strings"
+	"unsafe"
+)
+
+type ResetType int
+
+const (
+	RESET_SOFT ResetType = iota + 1
+	RESET_MIXED
+	RESET_HARD
+)
+
+func (resetType ResetType) String() string {
+	switch resetType {
+	case RESET_SOFT:
+		return "soft"
+	case RESET_MIXED:
+		return "mixed"
+	case RESET_HARD:
+		return "hard"
+	}
+	return "unknown"
+}
+
+// Peel an object (a commit or a chain of tags) down to a commit.
+func (repo *Repository) peelToCommit(obj *Object) (*Commit, error) {
+	switch obj.Type() {
+	case OBJ_COMMIT:
+		return repo.LookupCommit(obj.Id())
+	case OBJ_TAG:
+		tag, err := repo.LookupTag(obj.Id())
+		if err != nil {
+			return nil, err
+		}
+		defer tag.Free()
+		target, err := tag.Target()
+		if err != nil {
+			return nil, err
+		}
+		defer target.Free()
+		return repo.peelToCommit(target)
+	}
+	return nil, errors.New("git2: object cannot be peeled to a commit")
+}
+
+// Move the branch HEAD points at (or HEAD itself when detached) to target.
+// RESET_MIXED also resets the index to the target's tree and RESET_HARD
+// additionally checks the index out into the working directory, using
+// CHECKOUT_FORCE when checkoutOpts is nil.
+func (repo *Repository) Reset(target *Object, resetType ResetType, checkoutOpts *CheckoutOpts) error {
+	if resetType < RESET_SOFT || resetType > RESET_HARD {
+		return errors.New("git2: invalid reset type")
+	}
+	if resetType != RESET_SOFT && repo.Bare() {
+		return errors.New("git2: cannot do a " + resetType.String() + " reset in a bare repository")
+	}
+
+	commit, err := repo.peelToCommit(target)
+	if err != nil {
+		return err
+	}
+	defer commit.Free()
+
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	defer head.Free()
+
+	// libgit2 logs the move in the reflogs of the branch and of HEAD.
+	msg := "reset: moving to " + commit.Id().String()
+	if err = head.setOid(commit.Id(), msg); err != nil {
+		return err
+	}
+
+	if resetType == RESET_SOFT {
+		return nil
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	defer tree.Free()
+
+	index, err := repo.Index()
+	if err != nil {
+		return err
+	}
+	defer index.Free()
+	if err = index.ReadTree(tree); err != nil {
+		return err
+	}
+	if err = index.Write(); err != nil {
+		return err
+	}
+
+	if resetType == RESET_MIXED {
+		return nil
+	}
+
+	if checkoutOpts == nil {
+		checkoutOpts = &CheckoutOpts{Strategy: CHECKOUT_FORCE}
+	}
+	return repo.CheckoutIndex(index, checkoutOpts)
+}
+
+// Reset the index entries of paths to their state in target, leaving HEAD
+// and the working directory alone. Paths missing from target are removed
+// from the index. A nil target resets against HEAD.
+func (repo *Repository) ResetPaths(target *Object, paths ...string) error {
+	if repo.Bare() {
+		return errors.New("git2: cannot reset paths in a bare repository")
+	}
+
+	var commit *Commit
+	var err error
+	if target == nil {
+		var head *Reference
+		head, err = repo.Head()
+		if err != nil {
+			return err
+		}
+		defer head.Free()
+		commit, err = repo.LookupCommit(head.Oid())
+	} else {
+		commit, err = repo.peelToCommit(target)
+	}
+	if err != nil {
+		return err
+	}
+	defer commit.Free()
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	defer tree.Free()
+
+	index, err := repo.Index()
+	if err != nil {
+		return err
+	}
+	defer index.Free()
+
+	for _, p := range paths {
+		p = path.Clean(p)
+		if err = removeIndexPath(index, p); err != nil {
+			return err
+		}
+
+		entry := treeEntryByPath(tree, p)
+		if entry == nil {
+			continue
+		}
+		if entry.Type() == OBJ_TREE {
+			var subtree *Tree
+			subtree, err = repo.LookupTree(entry.Id())
+			if err == nil {
+				err = repo.addTreeToIndex(index, subtree, p)
+				subtree.Free()
+			}
+		} else {
+			err = addIndexEntry(index, p, entry)
+		}
+		entry.Free()
+		if err != nil {
+			return err
+		}
+	}
+
+	return index.Write()
+}
+
+// Remove the index entries for p and, when it is a directory, for
+// everything below it.
+func removeIndexPath(index *Index, p string) error {
+	prefix := p + "/"
+	// Removing an entry shifts those after it, so go backwards.
+	for n := int(index.EntryCount()) - 1; n >= 0; n-- {
+		name := index.Get(uint(n)).Path()
+		if name != p && !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if err := index.Remove(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stage every blob and submodule below tree, whose path is prefix.
+func (repo *Repository) addTreeToIndex(index *Index, tree *Tree, prefix string) error {
+	for i := uint(0); i < tree.EntryCount(); i++ {
+		entry := tree.EntryByIndex(i)
+		p := path.Join(prefix, entry.Name())
+		var err error
+		if entry.Type() == OBJ_TREE {
+			var subtree *Tree
+			subtree, err = repo.LookupTree(entry.Id())
+			if err == nil {
+				err = repo.addTreeToIndex(index, subtree, p)
+				subtree.Free()
+			}
+		} else {
+			err = addIndexEntry(index, p, entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addIndexEntry(index *Index, p string, entry *TreeEntry) error {
+	var centry C.git_index_entry
+	cpath := C.CString(p)
+	defer C.free(unsafe.Pointer(cpath))
+	centry.path = cpath
+	centry.mode = C.uint32_t(entry.Attributes())
+	C.git_oid_cpy(&centry.id, entry.Id().git_oid)
+	return index.AddEntry(&IndexEntry{&centry})
+}
+
+// Find the entry at a slash separated path within tree, or nil if there is
+// no such entry. The returned entry must be freed by the caller.
+func treeEntryByPath(tree *Tree, p string) *TreeEntry {
+	dir, file := path.Split(p)
+	dir = path.Clean(dir)
+	if dir != "." && dir != "/" {
+		subtree, err := tree.Subtree(dir)
+		if err != nil {
+			// The parent directory does not exist in the tree.
+			return nil
+		}
+		defer subtree.Free()
+		tree = subtree
+	}
+	entry := tree.EntryByName(file)
+	if entry.git_tree_entry == nil {
+		return nil
+	}
+	// The entry is owned by tree, which may be freed above.
+	dup := new(TreeEntry)
+	dup.git_tree_entry = C.git_tree_entry_dup(entry.git_tree_entry)
+	return dup
+}
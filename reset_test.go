@@ -0,0 +1,91 @@
+package git2
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestResetHard(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+
+	first := commitTestFiles(t, repo, map[string]string{"file": "one"}, "first")
+	commitTestFiles(t, repo, map[string]string{"file": "two"}, "second")
+
+	target, err := repo.LookupObject(first, OBJ_COMMIT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Free()
+	if err = repo.Reset(target, RESET_HARD, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer head.Free()
+	if head.Oid().Compare(first) != 0 {
+		t.Errorf("HEAD is %s, want %s", head.Oid(), first)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(repo.Workdir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "one" {
+		t.Errorf("file holds %q, want %q", data, "one")
+	}
+}
+
+func TestResetPathsDirectory(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+
+	commitTestFiles(t, repo, map[string]string{
+		"dir/a":     "a1",
+		"dir/sub/b": "b1",
+		"top":       "t1",
+	}, "first")
+
+	// Change, add and remove files below dir, and change one outside it.
+	index, err := repo.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Free()
+	writeTestFile(t, repo, "dir/a", "a2")
+	writeTestFile(t, repo, "dir/c", "c2")
+	writeTestFile(t, repo, "top", "t2")
+	for _, name := range []string{"dir/a", "dir/c", "top"} {
+		if err = index.Add(name, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = index.Remove(index.Find("dir/sub/b")); err != nil {
+		t.Fatal(err)
+	}
+	if err = index.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = repo.ResetPaths(nil, "dir/"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := testIndexEntries(t, repo)
+	want := map[string]string{
+		"dir/a":     testBlobId(t, repo, "a1").String(),
+		"dir/sub/b": testBlobId(t, repo, "b1").String(),
+		"top":       testBlobId(t, repo, "t2").String(),
+	}
+	if len(entries) != len(want) {
+		t.Errorf("index holds %v, want %v", entries, want)
+	}
+	for name, id := range want {
+		if entries[name] != id {
+			t.Errorf("%s is staged as %q, want %s", name, entries[name], id)
+		}
+	}
+}
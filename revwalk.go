@@ -66,6 +66,7 @@ func (revwalk *Revwalk) HideRef(ref string) error {
 
 func (revwalk *Revwalk) Next() (*Oid, error) {
 	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
 	ecode := C.git_revwalk_next(oid.git_oid, revwalk.git_revwalk)
 	if ecode == 0 {
 		return oid, nil
@@ -120,14 +121,24 @@ func (revwalk *Revwalk) Repository() *Repository {
 	return repo
 }
 
-func (revwalk *Revwalk) Reset() {
-	C.git_revwalk_reset(revwalk.git_revwalk)
+func (revwalk *Revwalk) Reset() error {
+	ecode := C.git_revwalk_reset(revwalk.git_revwalk)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
 }
 
-func (revwalk *Revwalk) Sorting(sort SortMode) {
-	C.git_revwalk_sorting(revwalk.git_revwalk, C.uint(sort))
+func (revwalk *Revwalk) Sorting(sort SortMode) error {
+	ecode := C.git_revwalk_sorting(revwalk.git_revwalk, C.uint(sort))
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
 }
 
+// In a shallow repository the walk stops at the shallow roots, which are
+// treated as commits without parents.
 func (repo *Repository) NewRevwalk() (*Revwalk, error) {
 	revwalk := new(Revwalk)
 	ecode := C.git_revwalk_new(&revwalk.git_revwalk, repo.git_repository)
@@ -0,0 +1,568 @@
+package git2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The server side of the git smart protocol, shared by the HTTP handler in
+// git2http and the git:// daemon.
+
+const git_AGENT = "agent=go-git2"
+
+var git_ZERO_HEX = strings.Repeat("0", git_OID_HEXSZ)
+
+type advertisedRef struct {
+	name   string
+	id     *Oid
+	peeled *Oid
+}
+
+// Resolve ref to the object it points at, following symbolic references.
+func (repo *Repository) referenceTarget(ref *Reference) (*Oid, error) {
+	if ref.Type()&REF_SYMBOLIC == 0 {
+		return ref.Oid().Copy(), nil
+	}
+	resolved, err := ref.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	defer resolved.Free()
+	return resolved.Oid().Copy(), nil
+}
+
+// The object an annotated tag ultimately points at, nil when id is not a
+// tag.
+func (repo *Repository) peelTag(id *Oid) *Oid {
+	tag, err := repo.LookupTag(id)
+	if err != nil {
+		return nil
+	}
+	defer tag.Free()
+	obj, err := tag.Peel()
+	if err != nil {
+		return nil
+	}
+	defer obj.Free()
+	return obj.Id().Copy()
+}
+
+func (repo *Repository) advertisedRefs(includeHead bool) ([]advertisedRef, string, error) {
+	var refs []advertisedRef
+	var headTarget string
+
+	if includeHead {
+		if head, err := repo.LookupReference("HEAD"); err == nil {
+			if head.Type()&REF_SYMBOLIC != 0 {
+				headTarget = head.Target()
+			}
+			// An unborn HEAD is not advertised.
+			if id, err := repo.referenceTarget(head); err == nil {
+				refs = append(refs, advertisedRef{name: "HEAD", id: id})
+			}
+			head.Free()
+		}
+	}
+
+	names, err := repo.ListReferences(REF_LISTALL)
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ref, err := repo.LookupReference(name)
+		if err != nil {
+			return nil, "", err
+		}
+		id, err := repo.referenceTarget(ref)
+		ref.Free()
+		if err != nil {
+			// Dangling symbolic references are left out.
+			continue
+		}
+		refs = append(refs, advertisedRef{name: name, id: id, peeled: repo.peelTag(id)})
+	}
+	return refs, headTarget, nil
+}
+
+// Write the reference advertisement for service, SERVICE_UPLOADPACK or
+// SERVICE_RECEIVEPACK, which starts every exchange with a client.
+func (repo *Repository) AdvertiseRefs(w io.Writer, service SmartService) error {
+	var capabilities string
+	var refs []advertisedRef
+	var err error
+	switch service {
+	case SERVICE_UPLOADPACK, SERVICE_UPLOADPACK_LS:
+		var headTarget string
+		refs, headTarget, err = repo.advertisedRefs(true)
+		capabilities = "side-band-64k ofs-delta no-progress shallow"
+		if headTarget != "" {
+			capabilities += " symref=HEAD:" + headTarget
+		}
+	case SERVICE_RECEIVEPACK, SERVICE_RECEIVEPACK_LS:
+		refs, _, err = repo.advertisedRefs(false)
+		capabilities = "report-status delete-refs atomic side-band-64k ofs-delta"
+	default:
+		return errors.New("git2: unknown service")
+	}
+	if err != nil {
+		return err
+	}
+	return writeAdvertisement(w, refs, capabilities+" "+git_AGENT)
+}
+
+func writeAdvertisement(w io.Writer, refs []advertisedRef, capabilities string) error {
+	var err error
+	if len(refs) == 0 {
+		if err = writePktString(w, "%s capabilities^{}\x00%s\n", git_ZERO_HEX, capabilities); err != nil {
+			return err
+		}
+		return writeFlush(w)
+	}
+	for i, ref := range refs {
+		if i == 0 {
+			err = writePktString(w, "%s %s\x00%s\n", ref.id, ref.name, capabilities)
+		} else {
+			err = writePktString(w, "%s %s\n", ref.id, ref.name)
+		}
+		if err != nil {
+			return err
+		}
+		if ref.peeled != nil {
+			if err = writePktString(w, "%s %s^{}\n", ref.peeled, ref.name); err != nil {
+				return err
+			}
+		}
+	}
+	return writeFlush(w)
+}
+
+func parseCapabilities(list string) map[string]bool {
+	capabilities := make(map[string]bool)
+	for _, capability := range strings.Fields(list) {
+		capabilities[capability] = true
+	}
+	return capabilities
+}
+
+func parseOid(hex string) (*Oid, error) {
+	if len(hex) != git_OID_HEXSZ {
+		return nil, errors.New("git2: malformed object id " + hex)
+	}
+	return OidFromString(hex), nil
+}
+
+type uploadRequest struct {
+	wants        []*Oid
+	common       []*Oid
+	capabilities map[string]bool
+	// The client's shallow roots and the depth it asked to deepen to, 0
+	// when it did not.
+	shallows []*Oid
+	depth    int
+}
+
+// Read what the client wants and negotiate what it already has, has telling
+// which objects are known on this side. deepen, nil when shallow fetches
+// are not supported, answers a request to deepen before the negotiation.
+// The result is nil when there is no pack to send yet: the client hung up
+// or, with statelessRPC, the request ended without "done".
+func readUploadRequest(br *bufio.Reader, w io.Writer, statelessRPC bool, has func(*Oid) bool, deepen func(*uploadRequest) error) (*uploadRequest, error) {
+	req := new(uploadRequest)
+	for {
+		line, err := readPkt(br)
+		if err == io.EOF && len(req.wants) == 0 {
+			// The client only wanted the advertisement.
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if line == nil {
+			break
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if strings.HasPrefix(text, "shallow ") {
+			oid, err := parseOid(text[len("shallow "):])
+			if err != nil {
+				return nil, err
+			}
+			req.shallows = append(req.shallows, oid)
+			continue
+		}
+		if strings.HasPrefix(text, "deepen ") {
+			depth, err := strconv.Atoi(text[len("deepen "):])
+			if err != nil || depth <= 0 {
+				return nil, errors.New("git2: malformed deepen line: " + text)
+			}
+			req.depth = depth
+			continue
+		}
+		if !strings.HasPrefix(text, "want ") {
+			return nil, errors.New("git2: unexpected line in upload-pack request: " + text)
+		}
+		fields := strings.SplitN(text[len("want "):], " ", 2)
+		oid, err := parseOid(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		if req.capabilities == nil {
+			req.capabilities = make(map[string]bool)
+			if len(fields) > 1 {
+				req.capabilities = parseCapabilities(fields[1])
+			}
+		}
+		req.wants = append(req.wants, oid)
+	}
+	if len(req.wants) == 0 {
+		return nil, nil
+	}
+	if req.depth > 0 {
+		if deepen == nil {
+			return nil, errors.New("git2: shallow fetches are not supported")
+		}
+		if err := deepen(req); err != nil {
+			return nil, err
+		}
+	}
+
+	// Without multi_ack the first common object is acknowledged right away
+	// and every flush gets a NAK until then.
+	acked := false
+	for {
+		line, err := readPkt(br)
+		if err == io.EOF && statelessRPC && req.depth > 0 {
+			// The request only asked to deepen, the haves follow in the
+			// next one.
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if line == nil {
+			if !acked {
+				if err = writePktString(w, "NAK\n"); err != nil {
+					return nil, err
+				}
+			}
+			if statelessRPC {
+				return nil, nil
+			}
+			continue
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if text == "done" {
+			if !acked {
+				if err = writePktString(w, "NAK\n"); err != nil {
+					return nil, err
+				}
+			}
+			return req, nil
+		}
+		if !strings.HasPrefix(text, "have ") {
+			return nil, errors.New("git2: unexpected line in upload-pack request: " + text)
+		}
+		oid, err := parseOid(text[len("have "):])
+		if err != nil {
+			return nil, err
+		}
+		if !has(oid) {
+			continue
+		}
+		req.common = append(req.common, oid)
+		if !acked {
+			if err = writePktString(w, "ACK %s\n", oid); err != nil {
+				return nil, err
+			}
+			acked = true
+		}
+	}
+}
+
+// Serve git-upload-pack on a connection whose references have already been
+// advertised. With statelessRPC, as used over HTTP, r holds a single
+// request and the function returns after answering it.
+func (repo *Repository) UploadPack(r io.Reader, w io.Writer, statelessRPC bool) error {
+	odb, err := repo.Odb()
+	if err != nil {
+		return err
+	}
+	defer odb.Free()
+
+	// Only what was advertised may be asked for. Over HTTP the
+	// advertisement was a separate request, so list the references again.
+	refs, _, err := repo.advertisedRefs(true)
+	if err != nil {
+		return err
+	}
+	advertised := make(map[string]bool)
+	for _, ref := range refs {
+		advertised[ref.id.String()] = true
+		if ref.peeled != nil {
+			advertised[ref.peeled.String()] = true
+		}
+	}
+	checkWants := func(req *uploadRequest) error {
+		for _, want := range req.wants {
+			if !advertised[want.String()] {
+				return errors.New("git2: not our ref " + want.String())
+			}
+		}
+		return nil
+	}
+
+	deepen := func(req *uploadRequest) error {
+		if err := checkWants(req); err != nil {
+			return err
+		}
+		return repo.writeShallowUpdate(w, req)
+	}
+	req, err := readUploadRequest(bufio.NewReader(r), w, statelessRPC, odb.Exists, deepen)
+	if req == nil {
+		return err
+	}
+
+	pack := func(w io.Writer) error {
+		if err := checkWants(req); err != nil {
+			return err
+		}
+		return repo.writeUploadPack(w, req.wants, req.common, req.shallows, req.depth)
+	}
+
+	sideband := req.capabilities["side-band-64k"] || req.capabilities["side-band"]
+	if !sideband {
+		return pack(w)
+	}
+	err = pack(&sidebandWriter{w, git_SIDEBAND_DATA})
+	if err != nil {
+		errWriter := &sidebandWriter{w, git_SIDEBAND_ERROR}
+		fmt.Fprintf(errWriter, "error: %s\n", err)
+	}
+	if flushErr := writeFlush(w); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// Write a pack of wants without what the client has, which is common and
+// everything it reaches. shallows are the client's shallow roots, whose
+// parents it does not have, and depth the number of commits from each
+// want to send, 0 meaning all of them.
+func (repo *Repository) writeUploadPack(w io.Writer, wants, common, shallows []*Oid, depth int) error {
+	pb, err := repo.NewPackBuilder()
+	if err != nil {
+		return err
+	}
+	defer pb.Free()
+
+	var commits []*Oid
+	for _, want := range wants {
+		obj, err := repo.LookupObject(want, OBJ_ANY)
+		if err != nil {
+			return errors.New("git2: not our ref " + want.String())
+		}
+		objType := obj.Type()
+		obj.Free()
+
+		if objType == OBJ_TAG {
+			if err = pb.Insert(want, ""); err != nil {
+				return err
+			}
+			peeled := repo.peelTag(want)
+			if peeled == nil {
+				return errors.New("git2: cannot peel tag " + want.String())
+			}
+			want = peeled
+			if obj, err = repo.LookupObject(want, OBJ_ANY); err != nil {
+				return err
+			}
+			objType = obj.Type()
+			obj.Free()
+		}
+		if objType == OBJ_COMMIT {
+			commits = append(commits, want)
+		} else if err = pb.InsertRecursive(want, ""); err != nil {
+			return err
+		}
+	}
+	if len(shallows) == 0 && depth == 0 {
+		err = repo.insertUploadWalk(pb, commits, common)
+	} else {
+		err = repo.insertShallowUpload(pb, commits, common, shallows, depth)
+	}
+	if err != nil {
+		return err
+	}
+	return pb.Write(w)
+}
+
+func (repo *Repository) insertUploadWalk(pb *PackBuilder, commits, common []*Oid) error {
+	if len(commits) == 0 {
+		return nil
+	}
+	walk, err := repo.NewRevwalk()
+	if err != nil {
+		return err
+	}
+	defer walk.Free()
+	for _, id := range commits {
+		if err = walk.Push(id); err != nil {
+			return err
+		}
+	}
+	for _, have := range common {
+		if commit, err := repo.LookupCommit(have); err == nil {
+			commit.Free()
+			if err = walk.Hide(have); err != nil {
+				return err
+			}
+		}
+	}
+	return pb.InsertWalk(walk)
+}
+
+// A revwalk cannot follow the client's shallow roots or stop at a depth, so
+// work out the commits to send by hand. The trees of the commits the client
+// has are not left out, only the commits themselves.
+func (repo *Repository) insertShallowUpload(pb *PackBuilder, commits, common, shallows []*Oid, depth int) error {
+	roots := oidSet(shallows)
+	// Deepening goes past the client's shallow roots, otherwise they end
+	// its history as they end the client's.
+	stop := roots
+	if depth > 0 {
+		stop = nil
+	}
+	send, _, err := repo.shallowWalk(commits, depth, stop)
+	if err != nil {
+		return err
+	}
+	var haves []*Oid
+	for _, have := range common {
+		if commit, err := repo.LookupCommit(have); err == nil {
+			commit.Free()
+			haves = append(haves, have)
+		}
+	}
+	has, _, err := repo.shallowWalk(haves, 0, roots)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(send))
+	for key := range send {
+		if _, ok := has[key]; !ok {
+			ids = append(ids, key)
+		}
+	}
+	sort.Strings(ids)
+	for _, key := range ids {
+		if err = pb.InsertCommit(send[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func oidSet(ids []*Oid) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id.String()] = true
+	}
+	return set
+}
+
+// The commits reachable from starts in at most depth steps, each start
+// counting as the first, and the boundary among them: those whose parents
+// are left out because of depth. A depth of 0 or FETCH_DEPTH_UNSHALLOW
+// means no limit. The parents of the commits in stop are not followed.
+func (repo *Repository) shallowWalk(starts []*Oid, depth int, stop map[string]bool) (map[string]*Oid, map[string]bool, error) {
+	type queued struct {
+		id    *Oid
+		depth int
+	}
+	limited := depth > 0 && depth < FETCH_DEPTH_UNSHALLOW
+	reached := make(map[string]*Oid)
+	boundary := make(map[string]bool)
+	queue := make([]queued, len(starts))
+	for i, id := range starts {
+		queue[i] = queued{id, 1}
+	}
+	// Breadth first, so every commit is reached at its smallest depth.
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		key := next.id.String()
+		if _, ok := reached[key]; ok {
+			continue
+		}
+		reached[key] = next.id
+		if stop[key] {
+			continue
+		}
+		commit, err := repo.LookupCommit(next.id)
+		if err != nil {
+			return nil, nil, err
+		}
+		count := commit.ParentCount()
+		if limited && next.depth >= depth {
+			if count > 0 {
+				boundary[key] = true
+			}
+			commit.Free()
+			continue
+		}
+		for i := uint(0); i < count; i++ {
+			parent, err := commit.ParentOid(i)
+			if err != nil {
+				commit.Free()
+				return nil, nil, err
+			}
+			queue = append(queue, queued{parent, next.depth + 1})
+		}
+		commit.Free()
+	}
+	return reached, boundary, nil
+}
+
+// Answer a request to deepen with the commits that become shallow roots
+// on the client and those of its roots which no longer are.
+func (repo *Repository) writeShallowUpdate(w io.Writer, req *uploadRequest) error {
+	var commits []*Oid
+	for _, want := range req.wants {
+		if peeled := repo.peelTag(want); peeled != nil {
+			want = peeled
+		}
+		if commit, err := repo.LookupCommit(want); err == nil {
+			commit.Free()
+			commits = append(commits, want)
+		}
+	}
+	reached, boundary, err := repo.shallowWalk(commits, req.depth, nil)
+	if err != nil {
+		return err
+	}
+	roots := oidSet(req.shallows)
+	var shallow []string
+	for key := range boundary {
+		if !roots[key] {
+			shallow = append(shallow, key)
+		}
+	}
+	sort.Strings(shallow)
+	for _, key := range shallow {
+		if err = writePktString(w, "shallow %s\n", key); err != nil {
+			return err
+		}
+	}
+	for _, root := range req.shallows {
+		key := root.String()
+		if _, ok := reached[key]; ok && !boundary[key] {
+			if err = writePktString(w, "unshallow %s\n", key); err != nil {
+				return err
+			}
+		}
+	}
+	return writeFlush(w)
+}
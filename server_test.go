@@ -0,0 +1,148 @@
+package git2
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// An upload-pack request for wants without side-band, so a refused want is
+// returned by UploadPack itself.
+func uploadPackRequest(t *testing.T, wants ...*Oid) *bytes.Buffer {
+	var req bytes.Buffer
+	for i, want := range wants {
+		var err error
+		if i == 0 {
+			err = writePktString(&req, "want %s ofs-delta\n", want)
+		} else {
+			err = writePktString(&req, "want %s\n", want)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeFlush(&req); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePktString(&req, "done\n"); err != nil {
+		t.Fatal(err)
+	}
+	return &req
+}
+
+func TestUploadPackWants(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	first := commitTestFiles(t, repo, map[string]string{"file": "one"}, "first")
+	head := commitTestFiles(t, repo, map[string]string{"file": "two"}, "second")
+
+	target, err := repo.LookupObject(first, OBJ_COMMIT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Free()
+	sig := testSignature(t)
+	defer sig.Free()
+	tag, err := repo.CreateTag("v1", target, sig, "version one", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tag and the commit it peels to are both advertised.
+	for _, want := range []*Oid{head, tag, first} {
+		var out bytes.Buffer
+		if err = repo.UploadPack(uploadPackRequest(t, want), &out, false); err != nil {
+			t.Errorf("want %s: %v", want, err)
+		} else if !bytes.Contains(out.Bytes(), []byte("PACK")) {
+			t.Errorf("want %s: no pack was sent", want)
+		}
+	}
+}
+
+func TestUploadPackNotOurRef(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	first := commitTestFiles(t, repo, map[string]string{"file": "one"}, "first")
+	head := commitTestFiles(t, repo, map[string]string{"file": "two"}, "second")
+	blob := testBlobId(t, repo, "not referenced")
+
+	// Both objects exist, neither was advertised.
+	for _, want := range []*Oid{first, blob} {
+		var out bytes.Buffer
+		err := repo.UploadPack(uploadPackRequest(t, head, want), &out, false)
+		if err == nil || !strings.Contains(err.Error(), "not our ref") {
+			t.Errorf("want %s gave %v", want, err)
+		}
+		if bytes.Contains(out.Bytes(), []byte("PACK")) {
+			t.Errorf("want %s: a pack was sent", want)
+		}
+	}
+}
+
+func TestUploadPackDeepen(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	first := commitTestFiles(t, repo, map[string]string{"file": "one"}, "first")
+	second := commitTestFiles(t, repo, map[string]string{"file": "two"}, "second")
+	head := commitTestFiles(t, repo, map[string]string{"file": "three"}, "third")
+
+	request := func(depth int, shallows ...*Oid) *bytes.Buffer {
+		var req bytes.Buffer
+		writePktString(&req, "want %s ofs-delta\n", head)
+		for _, shallow := range shallows {
+			writePktString(&req, "shallow %s\n", shallow)
+		}
+		writePktString(&req, "deepen %d\n", depth)
+		writeFlush(&req)
+		writePktString(&req, "done\n")
+		return &req
+	}
+	// The shallow-update section comes first and ends with a flush.
+	shallowUpdate := func(out []byte) string {
+		br := bufio.NewReader(bytes.NewReader(out))
+		var update string
+		for {
+			line, err := readPkt(br)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == nil {
+				return update
+			}
+			update += string(line)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := repo.UploadPack(request(2), &out, false); err != nil {
+		t.Fatal(err)
+	}
+	update := shallowUpdate(out.Bytes())
+	if !strings.Contains(update, "shallow "+second.String()) || strings.Contains(update, "unshallow") {
+		t.Errorf("depth 2 gave the shallow update %q, want %s", update, second)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("PACK")) {
+		t.Error("no pack was sent")
+	}
+
+	// Deepening a client whose root is second unshallows it and makes
+	// first, which has no parents, the end of the history.
+	out.Reset()
+	if err := repo.UploadPack(request(3, second), &out, false); err != nil {
+		t.Fatal(err)
+	}
+	update = shallowUpdate(out.Bytes())
+	if update != fmt.Sprintf("unshallow %s\n", second) {
+		t.Errorf("depth 3 gave the shallow update %q, want %s unshallowed", update, second)
+	}
+
+	out.Reset()
+	if err := repo.UploadPack(request(FETCH_DEPTH_UNSHALLOW, second), &out, false); err != nil {
+		t.Fatal(err)
+	}
+	if update = shallowUpdate(out.Bytes()); strings.Contains(update, "shallow "+first.String()) {
+		t.Errorf("unshallowing gave the shallow update %q", update)
+	}
+}
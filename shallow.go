@@ -0,0 +1,86 @@
+package git2
+
+// #cgo pkg-config: libgit2
+// #include <git2.h>
+import "C"
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const git_SHALLOW_FILE = "shallow"
+
+func (repo *Repository) IsShallow() (bool, error) {
+	shallow := C.git_repository_is_shallow(repo.git_repository)
+	if shallow == c_TRUE {
+		return true, nil
+	} else if shallow == c_FALSE {
+		return false, nil
+	}
+	return false, gitError()
+}
+
+// The commits listed in .git/shallow, whose parents are missing from the
+// repository. Revwalks treat them as having no parents.
+func (repo *Repository) ShallowRoots() ([]*Oid, error) {
+	file, err := os.Open(filepath.Join(repo.Path(), git_SHALLOW_FILE))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var roots []*Oid
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) != git_OID_HEXSZ {
+			continue
+		}
+		roots = append(roots, OidFromString(line))
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return roots, nil
+}
+
+// Replace the contents of .git/shallow with roots, an empty list removes
+// the file and with it the repository's shallowness.
+func (repo *Repository) SetShallowRoots(roots []*Oid) error {
+	path := filepath.Join(repo.Path(), git_SHALLOW_FILE)
+	if len(roots) == 0 {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	lines := make([]string, len(roots))
+	for i, root := range roots {
+		lines[i] = root.String() + "\n"
+	}
+	// Write to a lock file first so readers never see a partial list. The
+	// lock must not exist already, another writer may be holding it.
+	lock := path + ".lock"
+	file, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(strings.Join(lines, ""))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(lock, path)
+	}
+	if err != nil {
+		os.Remove(lock)
+		return err
+	}
+	return nil
+}
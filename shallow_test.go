@@ -0,0 +1,157 @@
+package git2
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShallowRoots(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	first := commitTestFiles(t, repo, map[string]string{"file": "one"}, "first")
+	second := commitTestFiles(t, repo, map[string]string{"file": "two"}, "second")
+
+	if shallow, err := repo.IsShallow(); err != nil || shallow {
+		t.Fatalf("IsShallow gave %v, %v before any roots were set", shallow, err)
+	}
+	if err := repo.SetShallowRoots([]*Oid{first, second}); err != nil {
+		t.Fatal(err)
+	}
+	if shallow, err := repo.IsShallow(); err != nil || !shallow {
+		t.Errorf("IsShallow gave %v, %v", shallow, err)
+	}
+	roots, err := repo.ShallowRoots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 2 || roots[0].Compare(first) != 0 || roots[1].Compare(second) != 0 {
+		t.Errorf("shallow roots are %v", roots)
+	}
+
+	if err = repo.SetShallowRoots(nil); err != nil {
+		t.Fatal(err)
+	}
+	if roots, err = repo.ShallowRoots(); err != nil || len(roots) != 0 {
+		t.Errorf("ShallowRoots gave %v, %v after clearing", roots, err)
+	}
+}
+
+func TestSetShallowRootsLocked(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	head := commitTestFiles(t, repo, map[string]string{"file": "one"}, "first")
+
+	lock := filepath.Join(repo.Path(), "shallow.lock")
+	if err := ioutil.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetShallowRoots([]*Oid{head}); err == nil {
+		t.Error("wrote the shallow roots while shallow.lock existed")
+	}
+	if _, err := os.Stat(lock); err != nil {
+		t.Errorf("the other writer's lock is gone: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo.Path(), "shallow")); !os.IsNotExist(err) {
+		t.Errorf("shallow was written: %v", err)
+	}
+}
+
+func TestRevwalkStopsAtShallowRoots(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	commitTestFiles(t, repo, map[string]string{"file": "one"}, "first")
+	second := commitTestFiles(t, repo, map[string]string{"file": "two"}, "second")
+	third := commitTestFiles(t, repo, map[string]string{"file": "three"}, "third")
+	if err := repo.SetShallowRoots([]*Oid{second}); err != nil {
+		t.Fatal(err)
+	}
+
+	walk, err := repo.NewRevwalk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer walk.Free()
+	if err = walk.Push(third); err != nil {
+		t.Fatal(err)
+	}
+	var walked []*Oid
+	for {
+		id, err := walk.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id == nil {
+			break
+		}
+		walked = append(walked, id)
+	}
+	if len(walked) != 2 || walked[0].Compare(third) != 0 || walked[1].Compare(second) != 0 {
+		t.Errorf("walked %v, want [%s %s]", walked, third, second)
+	}
+}
+
+func TestFetchDepthAndUnshallow(t *testing.T) {
+	src, cleanupSrc := createTestRepo(t, false)
+	defer cleanupSrc()
+	first := commitTestFiles(t, src, map[string]string{"file": "one"}, "first")
+	second := commitTestFiles(t, src, map[string]string{"file": "two"}, "second")
+	third := commitTestFiles(t, src, map[string]string{"file": "three"}, "third")
+
+	// Serve the repository with UploadPack so that the depth goes through
+	// the smart protocol's shallow and deepen lines.
+	wrap := func(conn net.Conn) io.ReadWriteCloser { return conn }
+	if err := RegisterTransport("pipe://", pipeTransport(t, src, wrap)); err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterTransport("pipe://")
+
+	repo, cleanup := createTestRepo(t, true)
+	defer cleanup()
+	remote, err := repo.AddRemote("origin", "pipe://src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Free()
+	odb, err := repo.Odb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer odb.Free()
+
+	if err = remote.Fetch(nil, &FetchOptions{Depth: 2}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if shallow, err := repo.IsShallow(); err != nil || !shallow {
+		t.Errorf("IsShallow gave %v, %v after fetching two commits", shallow, err)
+	}
+	roots, err := repo.ShallowRoots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || roots[0].Compare(second) != 0 {
+		t.Errorf("shallow roots are %v, want [%s]", roots, second)
+	}
+	if err = odb.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if !odb.Exists(third) || !odb.Exists(second) || odb.Exists(first) {
+		t.Errorf("fetched %s %v, %s %v, %s %v", third, odb.Exists(third), second, odb.Exists(second), first, odb.Exists(first))
+	}
+
+	if err = remote.Fetch(nil, &FetchOptions{Depth: FETCH_DEPTH_UNSHALLOW}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if shallow, err := repo.IsShallow(); err != nil || shallow {
+		t.Errorf("IsShallow gave %v, %v after unshallowing", shallow, err)
+	}
+	if err = odb.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if !odb.Exists(first) {
+		t.Errorf("commit %s was not fetched when unshallowing", first)
+	}
+}
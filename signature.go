@@ -43,10 +43,32 @@ type Signature struct {
 
 func (sig *Signature) Duplicate() *Signature {
 	newSig := new(Signature)
-	newSig.git_signature = C.git_signature_dup(sig.git_signature)
+	ecode := C.git_signature_dup(&newSig.git_signature, sig.git_signature)
+	if ecode != git_SUCCESS {
+		return nil
+	}
 	return newSig
 }
 
 func (sig *Signature) Free() {
 	C.git_signature_free(sig.git_signature)
 }
+
+// Create a signature for the current time from the user.name and
+// user.email settings of the repository's configuration.
+func (repo *Repository) DefaultSignature() (*Signature, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	defer cfg.Free()
+	name, err := cfg.GetString("user.name")
+	if err != nil {
+		return nil, err
+	}
+	email, err := cfg.GetString("user.email")
+	if err != nil {
+		return nil, err
+	}
+	return SignatureNow(name, email)
+}
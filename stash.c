@@ -0,0 +1,26 @@
+#include <git2.h>
+#include "_cgo_export.h"
+
+int go_stash_apply_progress_callback2(git_stash_apply_progress_t progress, void *payload) {
+	return go_stash_apply_progress_callback(progress, (uintptr_t)payload);
+}
+
+int goStashApply(git_repository *repo, size_t index, uint32_t flags, uintptr_t payload) {
+	git_stash_apply_options opts = GIT_STASH_APPLY_OPTIONS_INIT;
+	opts.flags = flags;
+	if (payload != 0) {
+		opts.progress_cb = go_stash_apply_progress_callback2;
+		opts.progress_payload = (void *)payload;
+	}
+	return git_stash_apply(repo, index, &opts);
+}
+
+int goStashPop(git_repository *repo, size_t index, uint32_t flags, uintptr_t payload) {
+	git_stash_apply_options opts = GIT_STASH_APPLY_OPTIONS_INIT;
+	opts.flags = flags;
+	if (payload != 0) {
+		opts.progress_cb = go_stash_apply_progress_callback2;
+		opts.progress_payload = (void *)payload;
+	}
+	return git_stash_pop(repo, index, &opts);
+}
@@ -0,0 +1,152 @@
+package git2
+
+// #cgo pkg-config: libgit2
+// #include <git2.h>
+// extern int go_stash_apply_progress_callback(int progress, uintptr_t payload);
+// extern int goStashApply(git_repository *repo, size_t index, uint32_t flags, uintptr_t payload);
+// extern int goStashPop(git_repository *repo, size_t index, uint32_t flags, uintptr_t payload);
+import "C"
+import (
+	"unsafe"
+)
+
+const git_STASH_REF = "refs/stash"
+
+type StashFlag uint32
+
+const STASH_DEFAULT StashFlag = iota
+const (
+	STASH_KEEP_INDEX StashFlag = 1 << iota
+	STASH_INCLUDE_UNTRACKED
+	STASH_INCLUDE_IGNORED
+)
+
+type StashApplyFlag uint32
+
+const (
+	STASH_APPLY_DEFAULT StashApplyFlag = iota
+	STASH_APPLY_REINSTATE_INDEX
+)
+
+type StashApplyProgress int
+
+const (
+	STASH_APPLY_PROGRESS_NONE StashApplyProgress = iota
+	STASH_APPLY_PROGRESS_LOADING_STASH
+	STASH_APPLY_PROGRESS_ANALYZE_INDEX
+	STASH_APPLY_PROGRESS_ANALYZE_MODIFIED
+	STASH_APPLY_PROGRESS_ANALYZE_UNTRACKED
+	STASH_APPLY_PROGRESS_CHECKOUT_UNTRACKED
+	STASH_APPLY_PROGRESS_CHECKOUT_MODIFIED
+	STASH_APPLY_PROGRESS_DONE
+)
+
+func (repo *Repository) StashSave(stasher *Signature, message string, flags ...StashFlag) (*Oid, error) {
+	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
+	var cmessage *C.char
+	if message != "" {
+		cmessage = C.CString(message)
+		defer C.free(unsafe.Pointer(cmessage))
+	}
+	var cflags C.uint32_t
+	for _, flag := range flags {
+		cflags |= C.uint32_t(flag)
+	}
+	ecode := C.git_stash_save(oid.git_oid, repo.git_repository, stasher.git_signature, cmessage, cflags)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	return oid, nil
+}
+
+func (repo *Repository) StashApply(index uint, callback StashApplyProgressCallback, payload interface{}, flags ...StashApplyFlag) error {
+	var data C.uintptr_t
+	if callback != nil {
+		data = trackCallback(&stashApplyProgressCallbackWrapper{callback, payload})
+		defer untrackCallback(data)
+	}
+	var cflags C.uint32_t
+	for _, flag := range flags {
+		cflags |= C.uint32_t(flag)
+	}
+	ecode := C.goStashApply(repo.git_repository, C.size_t(index), cflags, data)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+func (repo *Repository) StashPop(index uint, callback StashApplyProgressCallback, payload interface{}, flags ...StashApplyFlag) error {
+	var data C.uintptr_t
+	if callback != nil {
+		data = trackCallback(&stashApplyProgressCallbackWrapper{callback, payload})
+		defer untrackCallback(data)
+	}
+	var cflags C.uint32_t
+	for _, flag := range flags {
+		cflags |= C.uint32_t(flag)
+	}
+	ecode := C.goStashPop(repo.git_repository, C.size_t(index), cflags, data)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+//export go_stash_apply_progress_callback
+func go_stash_apply_progress_callback(progress C.int, payload C.uintptr_t) C.int {
+	wrap := lookupCallback(payload).(*stashApplyProgressCallbackWrapper)
+	err := wrap.f(StashApplyProgress(progress), wrap.d)
+	if err != nil {
+		return C.int(git_SUCCESS - 1)
+	}
+	return C.int(git_SUCCESS)
+}
+
+type StashApplyProgressCallback func(progress StashApplyProgress, payload interface{}) error
+
+type stashApplyProgressCallbackWrapper struct {
+	f StashApplyProgressCallback
+	d interface{}
+}
+
+func (repo *Repository) StashDrop(index uint) error {
+	ecode := C.git_stash_drop(repo.git_repository, C.size_t(index))
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
+}
+
+// Call callback for every entry of refs/stash, starting with the most
+// recent one (stash@{0}). Nothing is called when there are no stashes.
+func (repo *Repository) ForEachStash(callback StashCallback, payload interface{}) error {
+	ref, err := repo.LookupReference(git_STASH_REF)
+	if IsNotFound(err) {
+		// No stash reference means there is nothing to iterate over.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer ref.Free()
+
+	reflog, err := ref.ReadReflog()
+	if err != nil {
+		return err
+	}
+	defer reflog.Free()
+
+	// Reflog entries are indexed from the newest, like stashes.
+	count := reflog.Count()
+	for i := uint(0); i < count; i++ {
+		entry := reflog.EntryByIndex(i)
+		err = callback(i, entry.Msg(), entry.NewOid(), payload)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type StashCallback func(index uint, message string, id *Oid, payload interface{}) error
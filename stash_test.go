@@ -0,0 +1,104 @@
+package git2
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStash(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+
+	err := repo.ForEachStash(func(index uint, message string, id *Oid, payload interface{}) error {
+		t.Errorf("unexpected stash %d", index)
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commitTestFiles(t, repo, map[string]string{"file": "committed"}, "first")
+	writeTestFile(t, repo, "file", "changed")
+	sig := testSignature(t)
+	defer sig.Free()
+	stashId, err := repo.StashSave(sig, "work in progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(repo.Workdir(), "file")
+	if data, _ := ioutil.ReadFile(path); string(data) != "committed" {
+		t.Errorf("file holds %q after stashing", data)
+	}
+
+	var stashes []*Oid
+	err = repo.ForEachStash(func(index uint, message string, id *Oid, payload interface{}) error {
+		stashes = append(stashes, id.Copy())
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stashes) != 1 || stashes[0].Compare(stashId) != 0 {
+		t.Fatalf("stashes are %v, want [%s]", stashes, stashId)
+	}
+
+	var progress []StashApplyProgress
+	err = repo.StashPop(0, func(p StashApplyProgress, payload interface{}) error {
+		progress = append(progress, p)
+		return nil
+	}, nil, STASH_APPLY_REINSTATE_INDEX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != STASH_APPLY_PROGRESS_DONE {
+		t.Errorf("progress was %v", progress)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "changed" {
+		t.Errorf("file holds %q after popping the stash", data)
+	}
+}
+
+func TestForEachStashOrder(t *testing.T) {
+	repo, cleanup := createTestRepo(t, false)
+	defer cleanup()
+	commitTestFiles(t, repo, map[string]string{"file": "committed"}, "first")
+	sig := testSignature(t)
+	defer sig.Free()
+
+	var ids []*Oid
+	for _, content := range []string{"one", "two"} {
+		writeTestFile(t, repo, "file", content)
+		id, err := repo.StashSave(sig, "stash "+content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	var messages []string
+	var stashes []*Oid
+	err := repo.ForEachStash(func(index uint, message string, id *Oid, payload interface{}) error {
+		if index != uint(len(stashes)) {
+			t.Errorf("index %d, want %d", index, len(stashes))
+		}
+		messages = append(messages, message)
+		stashes = append(stashes, id.Copy())
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stashes) != 2 {
+		t.Fatalf("%d stashes, want 2", len(stashes))
+	}
+	// stash@{0} is the second stash saved.
+	if !strings.HasSuffix(messages[0], "stash two") || stashes[0].Compare(ids[1]) != 0 {
+		t.Errorf("stash@{0} is %s %q, want %s", stashes[0], messages[0], ids[1])
+	}
+	if !strings.HasSuffix(messages[1], "stash one") || stashes[1].Compare(ids[0]) != 0 {
+		t.Errorf("stash@{1} is %s %q, want %s", stashes[1], messages[1], ids[0])
+	}
+}
@@ -2,9 +2,9 @@ package git2
 
 // #cgo pkg-config: libgit2
 // #include <git2.h>
-// extern int go_status_callback(char *path, unsigned int flags, void *payload);
-// extern int goStatusForEach(git_repository *repo, void *payload);
-// extern int goStatusForEachExt(git_repository *repo, git_status_options *opts, void *payload);
+// extern int go_status_callback(char *path, unsigned int flags, uintptr_t payload);
+// extern int goStatusForEach(git_repository *repo, uintptr_t payload);
+// extern int goStatusForEachExt(git_repository *repo, git_status_options *opts, uintptr_t payload);
 import "C"
 import (
 	"unsafe"
@@ -12,15 +12,15 @@ import (
 
 type StatusFlag uint
 
-const STATUS_CURRENT StatusFlag = iota
 const (
-	STATUS_INDEX_NEW StatusFlag = 1 << iota
-	STATUS_INDEX_MODIFIED
-	STATUS_INDEX_DELETED
-	STATUS_WT_NEW
-	STATUS_WT_MODIFIED
-	STATUS_WT_DELETED
-	STATUS_IGNORED
+	STATUS_CURRENT        StatusFlag = C.GIT_STATUS_CURRENT
+	STATUS_INDEX_NEW      StatusFlag = C.GIT_STATUS_INDEX_NEW
+	STATUS_INDEX_MODIFIED StatusFlag = C.GIT_STATUS_INDEX_MODIFIED
+	STATUS_INDEX_DELETED  StatusFlag = C.GIT_STATUS_INDEX_DELETED
+	STATUS_WT_NEW         StatusFlag = C.GIT_STATUS_WT_NEW
+	STATUS_WT_MODIFIED    StatusFlag = C.GIT_STATUS_WT_MODIFIED
+	STATUS_WT_DELETED     StatusFlag = C.GIT_STATUS_WT_DELETED
+	STATUS_IGNORED        StatusFlag = C.GIT_STATUS_IGNORED
 )
 
 type StatusOptions struct {
@@ -28,7 +28,8 @@ type StatusOptions struct {
 }
 
 func (repo *Repository) ForEachStatus(callback StatusCallback, payload interface{}) error {
-	data := unsafe.Pointer(&statusCallbackWrapper{callback, payload})
+	data := trackCallback(&statusCallbackWrapper{callback, payload})
+	defer untrackCallback(data)
 	ecode := C.goStatusForEach(repo.git_repository, data)
 	if ecode != git_SUCCESS {
 		return gitError()
@@ -37,7 +38,8 @@ func (repo *Repository) ForEachStatus(callback StatusCallback, payload interface
 }
 
 func (repo *Repository) ForEachExtStatus(opts StatusOptions, callback StatusCallback, payload interface{}) error {
-	data := unsafe.Pointer(&statusCallbackWrapper{callback, payload})
+	data := trackCallback(&statusCallbackWrapper{callback, payload})
+	defer untrackCallback(data)
 	ecode := C.goStatusForEachExt(repo.git_repository, opts.git_status_options, data)
 	if ecode != git_SUCCESS {
 		return gitError()
@@ -46,8 +48,8 @@ func (repo *Repository) ForEachExtStatus(opts StatusOptions, callback StatusCall
 }
 
 //export go_status_callback
-func go_status_callback(path *C.char, flags C.uint, payload unsafe.Pointer) C.int {
-	wrap := (*statusCallbackWrapper)(payload)
+func go_status_callback(path *C.char, flags C.uint, payload C.uintptr_t) C.int {
+	wrap := lookupCallback(payload).(*statusCallbackWrapper)
 	err := wrap.f(C.GoString(path), StatusFlag(flags), wrap.d)
 	if err != nil {
 		return C.int(git_SUCCESS - 1)
@@ -1,10 +1,11 @@
 #include <git2.h>
+#include "_cgo_export.h"
 
-int go_submodule_callback2(const char *path, void *payload) {
-	char *vpath = (char *)path;
-	return go_submodule_callback(vpath, payload);
+int go_submodule_callback2(git_submodule *sm, const char *name, void *payload) {
+	char *vpath = (char *)name;
+	return go_submodule_callback(vpath, (uintptr_t)payload);
 }
 
-int goSubmoduleForEach(git_repository *repo, void *payload) {
-	return git_submodule_foreach(repo, go_submodule_callback2, payload);
+int goSubmoduleForEach(git_repository *repo, uintptr_t payload) {
+	return git_submodule_foreach(repo, go_submodule_callback2, (void *)payload);
 }
@@ -2,8 +2,8 @@ package git2
 
 // #cgo pkg-config: libgit2
 // #include <git2.h>
-// extern int go_submodule_callback(char *path, void *payload);
-// extern int goSubmoduleForEach(git_repository *repo, void *payload);
+// extern int go_submodule_callback(char *path, uintptr_t payload);
+// extern int goSubmoduleForEach(git_repository *repo, uintptr_t payload);
 import "C"
 import (
 	"unsafe"
@@ -14,7 +14,8 @@ type Submodule struct {
 }
 
 func (repo *Repository) ForEachSubmodule(callback SubmoduleCallback, payload interface{}) error {
-	data := unsafe.Pointer(&submoduleCallbackWrapper{callback, payload})
+	data := trackCallback(&submoduleCallbackWrapper{callback, payload})
+	defer untrackCallback(data)
 	ecode := C.goSubmoduleForEach(repo.git_repository, data)
 	if ecode != git_SUCCESS {
 		return gitError()
@@ -23,8 +24,8 @@ func (repo *Repository) ForEachSubmodule(callback SubmoduleCallback, payload int
 }
 
 //export go_submodule_callback
-func go_submodule_callback(submodule *C.char, payload unsafe.Pointer) C.int {
-	wrap := (*submoduleCallbackWrapper)(payload)
+func go_submodule_callback(submodule *C.char, payload C.uintptr_t) C.int {
+	wrap := lookupCallback(payload).(*submoduleCallbackWrapper)
 	err := wrap.f(C.GoString(submodule), wrap.d)
 	if err != nil {
 		return C.int(git_SUCCESS - 1)
@@ -62,7 +62,7 @@ func (tag *Tag) Target() (*Object, error) {
 
 func (tag *Tag) TargetOid() *Oid {
 	oid := new(Oid)
-	oid.git_oid = C.git_tag_target_oid(tag.git_tag)
+	oid.git_oid = C.git_tag_target_id(tag.git_tag)
 	if oid.git_oid == nil {
 		return nil
 	}
@@ -70,11 +70,12 @@ func (tag *Tag) TargetOid() *Oid {
 }
 
 func (tag *Tag) Type() ObjectType {
-	return ObjectType(C.git_tag_type(tag.git_tag))
+	return ObjectType(C.git_tag_target_type(tag.git_tag))
 }
 
 func (repo *Repository) CreateTag(name string, target *Object, tagger *Signature, message string, force bool) (*Oid, error) {
 	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 	cmessage := C.CString(message)
@@ -92,13 +93,14 @@ func (repo *Repository) CreateTag(name string, target *Object, tagger *Signature
 
 func (repo *Repository) CreateTagFromBuffer(buffer string, force bool) (*Oid, error) {
 	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
 	cbuffer := C.CString(buffer)
 	defer C.free(unsafe.Pointer(cbuffer))
 	cforce := C.int(c_FALSE)
 	if force {
 		cforce = C.int(c_TRUE)
 	}
-	ecode := C.git_tag_create_frombuffer(oid.git_oid, repo.git_repository, cbuffer, cforce)
+	ecode := C.git_tag_create_from_buffer(oid.git_oid, repo.git_repository, cbuffer, cforce)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -107,6 +109,7 @@ func (repo *Repository) CreateTagFromBuffer(buffer string, force bool) (*Oid, er
 
 func (repo *Repository) CreateLightweightTag(name string, target Object, force bool) (*Oid, error) {
 	oid := new(Oid)
+	oid.git_oid = new(C.git_oid)
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 	cforce := C.int(c_FALSE)
@@ -132,7 +135,7 @@ func (repo *Repository) DeleteTag(name string) error {
 
 func (repo *Repository) TagList() ([]string, error) {
 	var ctags C.git_strarray
-	defer C.git_strarray_free(&ctags)
+	defer C.git_strarray_dispose(&ctags)
 	ecode := C.git_tag_list(&ctags, repo.git_repository)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
@@ -158,7 +161,7 @@ func (repo *Repository) TagListMatch(pattern string) ([]string, error) {
 	cpattern := C.CString(pattern)
 	defer C.free(unsafe.Pointer(cpattern))
 	var ctags C.git_strarray
-	defer C.git_strarray_free(&ctags)
+	defer C.git_strarray_dispose(&ctags)
 	ecode := C.git_tag_list_match(&ctags, cpattern, repo.git_repository)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
@@ -191,7 +194,7 @@ func (repo *Repository) LookupTag(id *Oid) (*Tag, error) {
 
 func (repo *Repository) LookupTagPrefix(id *Oid, n uint) (*Tag, error) {
 	tag := new(Tag)
-	ecode := C.git_tag_lookup_prefix(&tag.git_tag, repo.git_repository, id.git_oid, C.uint(n))
+	ecode := C.git_tag_lookup_prefix(&tag.git_tag, repo.git_repository, id.git_oid, C.size_t(n))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -0,0 +1,111 @@
+#include <stdlib.h>
+#include <git2.h>
+#include <git2/sys/transport.h>
+#include "_cgo_export.h"
+
+typedef struct {
+	git_smart_subtransport_stream parent;
+	uintptr_t handle;
+} go_stream;
+
+typedef struct {
+	git_smart_subtransport parent;
+	git_transport *owner;
+	uintptr_t factory;
+	go_stream *current;
+} go_subtransport;
+
+static int go_stream_read(git_smart_subtransport_stream *stream, char *buffer, size_t buf_size, size_t *bytes_read) {
+	go_stream *s = (go_stream *)stream;
+	return go_transport_stream_read(s->handle, buffer, buf_size, bytes_read);
+}
+
+static int go_stream_write(git_smart_subtransport_stream *stream, const char *buffer, size_t len) {
+	go_stream *s = (go_stream *)stream;
+	char *vbuffer = (char *)buffer;
+	return go_transport_stream_write(s->handle, vbuffer, len);
+}
+
+static void go_stream_free(git_smart_subtransport_stream *stream) {
+	go_stream *s = (go_stream *)stream;
+	go_subtransport *t = (go_subtransport *)stream->subtransport;
+	if (t->current == s) {
+		t->current = NULL;
+	}
+	go_transport_stream_free(s->handle);
+	free(s);
+}
+
+static int go_subtransport_action(git_smart_subtransport_stream **out, git_smart_subtransport *transport, const char *url, git_smart_service_t action) {
+	go_subtransport *t = (go_subtransport *)transport;
+	go_stream *s;
+	uintptr_t handle;
+	char *vurl = (char *)url;
+	int error;
+
+	/* The streams are stateful, the pack is exchanged over the connection
+	 * the references were listed on. */
+	if (action == GIT_SERVICE_UPLOADPACK || action == GIT_SERVICE_RECEIVEPACK) {
+		if (t->current == NULL) {
+			git_error_set_str(GIT_ERROR_NET, "git2: no connection for the requested service");
+			return -1;
+		}
+		*out = &t->current->parent;
+		return 0;
+	}
+
+	error = go_transport_connect(t->factory, vurl, action, &handle);
+	if (error < 0) {
+		return error;
+	}
+
+	s = calloc(1, sizeof(go_stream));
+	if (s == NULL) {
+		go_transport_stream_free(handle);
+		git_error_set_oom();
+		return -1;
+	}
+	s->parent.subtransport = transport;
+	s->parent.read = go_stream_read;
+	s->parent.write = go_stream_write;
+	s->parent.free = go_stream_free;
+	s->handle = handle;
+	t->current = s;
+	*out = &s->parent;
+	return 0;
+}
+
+static int go_subtransport_close(git_smart_subtransport *transport) {
+	go_subtransport *t = (go_subtransport *)transport;
+	t->current = NULL;
+	return 0;
+}
+
+static void go_subtransport_free(git_smart_subtransport *transport) {
+	go_subtransport_close(transport);
+	free(transport);
+}
+
+static int go_subtransport_cb(git_smart_subtransport **out, git_transport *owner, void *param) {
+	go_subtransport *t = calloc(1, sizeof(go_subtransport));
+	if (t == NULL) {
+		git_error_set_oom();
+		return -1;
+	}
+	t->parent.action = go_subtransport_action;
+	t->parent.close = go_subtransport_close;
+	t->parent.free = go_subtransport_free;
+	t->owner = owner;
+	t->factory = (uintptr_t)param;
+	*out = &t->parent;
+	return 0;
+}
+
+static int go_transport_cb(git_transport **out, git_remote *owner, void *param) {
+	git_smart_subtransport_definition definition = { go_subtransport_cb, 0, param };
+	return git_transport_smart(out, owner, &definition);
+}
+
+int goRegisterTransport(const char *prefix, uintptr_t factory) {
+	return git_transport_register(prefix, go_transport_cb, (void *)factory);
+}
@@ -0,0 +1,176 @@
+package git2
+
+// #cgo pkg-config: libgit2
+// #include <string.h>
+// #include <git2.h>
+// #include <git2/sys/transport.h>
+// extern int goRegisterTransport(const char *prefix, uintptr_t factory);
+import "C"
+import (
+	"errors"
+	"io"
+	"sync"
+	"unsafe"
+)
+
+type SmartService int
+
+const (
+	SERVICE_UPLOADPACK_LS SmartService = iota + 1
+	SERVICE_UPLOADPACK
+	SERVICE_RECEIVEPACK_LS
+	SERVICE_RECEIVEPACK
+)
+
+func (service SmartService) String() string {
+	switch service {
+	case SERVICE_UPLOADPACK_LS, SERVICE_UPLOADPACK:
+		return "git-upload-pack"
+	case SERVICE_RECEIVEPACK_LS, SERVICE_RECEIVEPACK:
+		return "git-receive-pack"
+	}
+	return "unknown"
+}
+
+// Open a connection to url over which the git smart protocol is spoken for
+// service, which is SERVICE_UPLOADPACK_LS for fetches and
+// SERVICE_RECEIVEPACK_LS for pushes. The reference advertisement and the
+// pack are exchanged over the same connection, which is closed when
+// libgit2 is done with it.
+type TransportFactory func(url string, service SmartService) (io.ReadWriteCloser, error)
+
+// Handles for the factories and streams libgit2 holds on to, Go pointers
+// cannot be kept in C memory.
+var transports = struct {
+	sync.Mutex
+	next      uintptr
+	factories map[uintptr]TransportFactory
+	prefixes  map[string]uintptr
+	streams   map[uintptr]io.ReadWriteCloser
+}{
+	factories: make(map[uintptr]TransportFactory),
+	prefixes:  make(map[string]uintptr),
+	streams:   make(map[uintptr]io.ReadWriteCloser),
+}
+
+// Use factory for remotes whose URL starts with prefix, e.g. "rpc://".
+func RegisterTransport(prefix string, factory TransportFactory) error {
+	transports.Lock()
+	defer transports.Unlock()
+	if _, ok := transports.prefixes[prefix]; ok {
+		return errors.New("git2: a transport is already registered for " + prefix)
+	}
+	transports.next++
+	handle := transports.next
+
+	cprefix := C.CString(prefix)
+	defer C.free(unsafe.Pointer(cprefix))
+	ecode := C.goRegisterTransport(cprefix, C.uintptr_t(handle))
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	transports.factories[handle] = factory
+	transports.prefixes[prefix] = handle
+	return nil
+}
+
+func UnregisterTransport(prefix string) error {
+	transports.Lock()
+	defer transports.Unlock()
+	cprefix := C.CString(prefix)
+	defer C.free(unsafe.Pointer(cprefix))
+	ecode := C.git_transport_unregister(cprefix)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	delete(transports.factories, transports.prefixes[prefix])
+	delete(transports.prefixes, prefix)
+	return nil
+}
+
+//export go_transport_connect
+func go_transport_connect(factory C.uintptr_t, url *C.char, service C.int, out *C.uintptr_t) C.int {
+	transports.Lock()
+	f, ok := transports.factories[uintptr(factory)]
+	transports.Unlock()
+	if !ok {
+		setGitError(C.GIT_ERROR_NET, errors.New("git2: transport has been unregistered"))
+		return C.int(git_SUCCESS - 1)
+	}
+
+	stream, err := f(C.GoString(url), SmartService(service))
+	if err != nil {
+		setGitError(C.GIT_ERROR_NET, err)
+		return C.int(git_SUCCESS - 1)
+	}
+
+	transports.Lock()
+	transports.next++
+	handle := transports.next
+	transports.streams[handle] = stream
+	transports.Unlock()
+	*out = C.uintptr_t(handle)
+	return C.int(git_SUCCESS)
+}
+
+func lookupTransportStream(handle C.uintptr_t) (io.ReadWriteCloser, C.int) {
+	transports.Lock()
+	stream := transports.streams[uintptr(handle)]
+	transports.Unlock()
+	if stream == nil {
+		setGitError(C.GIT_ERROR_NET, errors.New("git2: transport stream has been closed"))
+		return nil, C.int(git_SUCCESS - 1)
+	}
+	return stream, C.int(git_SUCCESS)
+}
+
+//export go_transport_stream_read
+func go_transport_stream_read(handle C.uintptr_t, buffer *C.char, size C.size_t, bytesRead *C.size_t) C.int {
+	stream, ecode := lookupTransportStream(handle)
+	if ecode != git_SUCCESS {
+		return ecode
+	}
+	buf := make([]byte, int(size))
+	// io.Reader allows returning nothing without an error, which libgit2
+	// would take for the end of the connection.
+	var n int
+	var err error
+	for n == 0 && err == nil {
+		n, err = stream.Read(buf)
+	}
+	if err != nil && err != io.EOF {
+		setGitError(C.GIT_ERROR_NET, err)
+		return C.int(git_SUCCESS - 1)
+	}
+	if n > 0 {
+		C.memcpy(unsafe.Pointer(buffer), unsafe.Pointer(&buf[0]), C.size_t(n))
+	}
+	// Reading nothing tells libgit2 the connection was closed.
+	*bytesRead = C.size_t(n)
+	return C.int(git_SUCCESS)
+}
+
+//export go_transport_stream_write
+func go_transport_stream_write(handle C.uintptr_t, buffer *C.char, length C.size_t) C.int {
+	stream, ecode := lookupTransportStream(handle)
+	if ecode != git_SUCCESS {
+		return ecode
+	}
+	data := C.GoBytes(unsafe.Pointer(buffer), C.int(length))
+	if _, err := stream.Write(data); err != nil {
+		setGitError(C.GIT_ERROR_NET, err)
+		return C.int(git_SUCCESS - 1)
+	}
+	return C.int(git_SUCCESS)
+}
+
+//export go_transport_stream_free
+func go_transport_stream_free(handle C.uintptr_t) {
+	transports.Lock()
+	stream := transports.streams[uintptr(handle)]
+	delete(transports.streams, uintptr(handle))
+	transports.Unlock()
+	if stream != nil {
+		stream.Close()
+	}
+}
@@ -0,0 +1,85 @@
+package git2
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+// Returns nothing every other read, which io.Reader allows.
+type stutteringConn struct {
+	net.Conn
+	stutter bool
+}
+
+func (conn *stutteringConn) Read(b []byte) (int, error) {
+	conn.stutter = !conn.stutter
+	if conn.stutter {
+		return 0, nil
+	}
+	return conn.Conn.Read(b)
+}
+
+// Serve upload-pack for repo on one end of an in-process pipe, handing the
+// other end to libgit2.
+func pipeTransport(t *testing.T, repo *Repository, wrap func(net.Conn) io.ReadWriteCloser) TransportFactory {
+	return func(url string, service SmartService) (io.ReadWriteCloser, error) {
+		if service != SERVICE_UPLOADPACK_LS {
+			t.Errorf("transport opened for %s", service)
+		}
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			if err := repo.AdvertiseRefs(server, SERVICE_UPLOADPACK); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := repo.UploadPack(server, server, false); err != nil {
+				t.Error(err)
+			}
+		}()
+		return wrap(client), nil
+	}
+}
+
+func testTransportFetch(t *testing.T, wrap func(net.Conn) io.ReadWriteCloser) {
+	src, cleanupSrc := createTestRepo(t, false)
+	defer cleanupSrc()
+	head := commitTestFiles(t, src, map[string]string{"file": "content"}, "first")
+
+	if err := RegisterTransport("pipe://", pipeTransport(t, src, wrap)); err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterTransport("pipe://")
+	if err := RegisterTransport("pipe://", pipeTransport(t, src, wrap)); err == nil {
+		t.Error("registered the same prefix twice")
+	}
+
+	repo, cleanup := createTestRepo(t, true)
+	defer cleanup()
+	remote, err := repo.AddRemote("origin", "pipe://src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Free()
+	if err = remote.Fetch(nil, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	odb, err := repo.Odb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer odb.Free()
+	if !odb.Exists(head) {
+		t.Errorf("commit %s was not fetched", head)
+	}
+}
+
+func TestTransportFetch(t *testing.T) {
+	testTransportFetch(t, func(conn net.Conn) io.ReadWriteCloser { return conn })
+}
+
+func TestTransportFetchEmptyReads(t *testing.T) {
+	testTransportFetch(t, func(conn net.Conn) io.ReadWriteCloser { return &stutteringConn{Conn: conn} })
+}
@@ -10,7 +10,7 @@ int go_tree_walk_callback2(const char *root, git_tree_entry *entry, void *payloa
 }
 
 int goTreeWalk(git_tree *tree, int mode, void *payload) {
-	return git_tree_walk(tree, go_tree_walk_callback2, mode, payload);
+	return git_tree_walk(tree, mode, go_tree_walk_callback2, payload);
 }
 
 int go_treebuilder_filter(git_tree_entry *entry, void *payload) {
@@ -22,6 +22,6 @@ int go_treebuilder_filter2(const git_tree_entry *entry, void *payload) {
 	return go_treebuilder_filter(ventry, payload);
 }
 
-void goTreeBuilderFilter(git_treebuilder *builder, void *payload) {
-	git_treebuilder_filter(builder, go_treebuilder_filter2, payload);
+int goTreeBuilderFilter(git_treebuilder *builder, void *payload) {
+	return git_treebuilder_filter(builder, go_treebuilder_filter2, payload);
 }
@@ -35,7 +35,7 @@ type Tree struct {
 
 func (tree *Tree) CreateTreeBuilder() (*TreeBuilder, error) {
 	builder := new(TreeBuilder)
-	ecode := C.git_treebuilder_create(&builder.git_treebuilder, tree.git_tree)
+	ecode := C.git_treebuilder_new(&builder.git_treebuilder, C.git_tree_owner(tree.git_tree), tree.git_tree)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -44,7 +44,7 @@ func (tree *Tree) CreateTreeBuilder() (*TreeBuilder, error) {
 
 func (tree *Tree) EntryByIndex(idx uint) *TreeEntry {
 	entry := new(TreeEntry)
-	entry.git_tree_entry = C.git_tree_entry_byindex(tree.git_tree, C.uint(idx))
+	entry.git_tree_entry = C.git_tree_entry_byindex(tree.git_tree, C.size_t(idx))
 	return entry
 }
 
@@ -74,10 +74,16 @@ func (tree *Tree) Id() *Oid {
 }
 
 func (tree *Tree) Subtree(path string) (*Tree, error) {
-	subtree := new(Tree)
+	var entry *C.git_tree_entry
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
-	ecode := C.git_tree_get_subtree(&subtree.git_tree, tree.git_tree, cpath)
+	ecode := C.git_tree_entry_bypath(&entry, tree.git_tree, cpath)
+	if ecode != git_SUCCESS {
+		return nil, gitError()
+	}
+	defer C.git_tree_entry_free(entry)
+	subtree := new(Tree)
+	ecode = C.git_tree_lookup(&subtree.git_tree, C.git_tree_owner(tree.git_tree), C.git_tree_entry_id(entry))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -117,8 +123,12 @@ type TreeBuilder struct {
 	git_treebuilder *C.git_treebuilder
 }
 
-func (builder *TreeBuilder) Clear() {
-	C.git_treebuilder_clear(builder.git_treebuilder)
+func (builder *TreeBuilder) Clear() error {
+	ecode := C.git_treebuilder_clear(builder.git_treebuilder)
+	if ecode != git_SUCCESS {
+		return gitError()
+	}
+	return nil
 }
 
 /* TODO: Resolve error: Go type not supported in export: [0]byte
@@ -165,7 +175,7 @@ func (builder *TreeBuilder) Insert(filename string, id *Oid, attributes FileMode
 	entry := new(TreeEntry)
 	cfilename := C.CString(filename)
 	defer C.free(unsafe.Pointer(cfilename))
-	ecode := C.git_treebuilder_insert(&entry.git_tree_entry, builder.git_treebuilder, cfilename, id.git_oid, C.uint(attributes))
+	ecode := C.git_treebuilder_insert(&entry.git_tree_entry, builder.git_treebuilder, cfilename, id.git_oid, C.git_filemode_t(attributes))
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -184,7 +194,8 @@ func (builder *TreeBuilder) Remove(filename string) error {
 
 func (builder *TreeBuilder) Write(repo *Repository) (*Oid, error) {
 	oid := new(Oid)
-	ecode := C.git_treebuilder_write(oid.git_oid, repo.git_repository, builder.git_treebuilder)
+	oid.git_oid = new(C.git_oid)
+	ecode := C.git_treebuilder_write(oid.git_oid, builder.git_treebuilder)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}
@@ -196,7 +207,11 @@ type TreeEntry struct {
 }
 
 func (entry *TreeEntry) Attributes() uint {
-	return uint(C.git_tree_entry_attributes(entry.git_tree_entry))
+	return uint(C.git_tree_entry_filemode(entry.git_tree_entry))
+}
+
+func (entry *TreeEntry) Free() {
+	C.git_tree_entry_free(entry.git_tree_entry)
 }
 
 func (entry *TreeEntry) Id() *Oid {
@@ -219,7 +234,7 @@ func (entry *TreeEntry) Type() ObjectType {
 func (idx *Index) CreateTree() (*Oid, error) {
 	oid := new(Oid)
 	oid.git_oid = new(C.git_oid)
-	ecode := C.git_tree_create_fromindex(oid.git_oid, idx.git_index)
+	ecode := C.git_index_write_tree(oid.git_oid, idx.git_index)
 	if ecode != git_SUCCESS {
 		return nil, gitError()
 	}